@@ -1,76 +1,246 @@
 package main
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"flag"
-	"log"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"temperature-simulator/internal/simulator"
 )
 
+// exitInterrupted is the exit status of a run stopped by SIGINT or SIGTERM before it completed,
+// following the shell convention of 128 plus the number of SIGINT.
+const exitInterrupted = 130
+
 // main is the entry point of the temperature simulator application.
 // It loads the sensor configuration, generates temperature readings,
-// and saves the results in a JSON file.
+// and streams the results to the configured sinks as they are produced.
 func main() {
-	// Parse command-line flags for configuration file, log level, log output, and output file.
-	sensorConfigFile := flag.String("sensor_config", "configs/sensors.json", "Path to the sensor configuration JSON file")
-	logLevel := flag.String("log_level", "info", "Log level (debug, info, warn, error)")
-	logOutput := flag.String("log_output", "", "Log output ('stdout' or file path), overrides config file log path")
-	outputFile := flag.String("output_file", "", "Output file for temperature readings, overrides config file output file")
+	// Parse command-line flags for configuration file, logging and configuration overrides.
+	sensorConfigFile := flag.String("sensor_config", "configs/sensors.json", "Path to the sensor configuration file (JSON, YAML or TOML)")
+	logLevel := flag.String("log_level", "info", "Log level (debug, info, warn, error); messages below it are discarded")
+	logFormat := flag.String("log_format", "text", "Log format (text, json)")
+	allowUnknownFields := flag.Bool("allow_unknown_fields", false, "Warn about unknown keys in the configuration file instead of rejecting it")
+	printConfig := flag.Bool("print_config", false, "Print the effective configuration as JSON, after applying environment variables and flags, and exit")
+	serveAddr := flag.String("serve", "", "Serve Prometheus metrics on this address (e.g. :9100) while generating and after completion")
+
+	// Every configuration setting can also be set with a flag, which takes precedence over its
+	// environment variable, which in turn takes precedence over the configuration file.
+	for _, option := range simulator.ConfigOptions() {
+		usage := fmt.Sprintf("%s, overrides %s and the config file", option.Usage, option.Env)
+		flag.Var(&configFlag{key: option.Key, isBool: option.Bool}, option.Flag, usage)
+	}
 	flag.Parse()
 
-	// Load the configuration and sensors from the JSON file.
-	sensorConfig, err := simulator.LoadConfigAndSensors(*sensorConfigFile)
+	// Until the configuration names the log output, log to stderr at the requested level and format.
+	logger, _, err := simulator.NewLogger(*logLevel, "stderr", *logFormat)
+	if err != nil {
+		slog.Error("Error setting up logger", "error", err)
+		os.Exit(1)
+	}
+
+	// Load the configuration and sensors from the configuration file.
+	sensorConfig, err := simulator.LoadConfigAndSensors(*sensorConfigFile, logger, simulator.LoadOptions{AllowUnknownFields: *allowUnknownFields})
 	if err != nil {
-		log.Fatalf("Error loading configuration and sensors: %v", err)
+		fatal(logger, "Error loading configuration and sensors", err)
 	}
 
-	// Use the log output from the config if the command-line flag is not provided.
+	// Override the configuration file with environment variables, and those with flags.
 	config := sensorConfig.Config
-	if *logOutput == "" {
-		*logOutput = config.LogFilePath
-		if *logOutput == "" {
-			*logOutput = "stdout" // Default to stdout if not specified in either place.
+	if err := config.ApplyEnv(os.LookupEnv); err != nil {
+		fatal(logger, "Error applying environment variable", err)
+	}
+	flag.Visit(func(f *flag.Flag) {
+		if setting, ok := f.Value.(*configFlag); ok {
+			// The value was checked when the flag was parsed, so it cannot fail here.
+			_ = config.Set(setting.key, setting.value)
+		}
+	})
+	sensorConfig.Config = config
+
+	if *printConfig {
+		// Print a copy without secrets, since the output often ends up in terminals and bug reports.
+		printed := sensorConfig
+		printed.Config = config.Redacted()
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(printed); err != nil {
+			fatal(logger, "Error printing configuration", err)
 		}
+		return
 	}
 
-	// Use the output file from the command-line flag, if provided, otherwise use the one from the config.
-	if *outputFile != "" {
-		config.OutputFileName = *outputFile
+	// Validate the effective configuration before any work starts, reporting every problem at once.
+	if err := sensorConfig.Validate(); err != nil {
+		var validationErrs simulator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			fatal(logger, "Error validating configuration", err)
+		}
+		for _, fieldErr := range validationErrs {
+			logger.Error("Invalid configuration setting", "field", fieldErr.Path, "error", fieldErr.Message)
+		}
+		logger.Error("Configuration is invalid", "file", *sensorConfigFile, "problems", len(validationErrs))
+		os.Exit(1)
 	}
 
-	// Setup logger based on the log level and output destination.
-	if err := simulator.SetupLogger(*logLevel, *logOutput); err != nil {
-		log.Fatalf("Error setting up logger: %v", err)
+	// Setup logger based on the log level, output destination and format, logging to stdout unless
+	// the configuration names another output, or to stderr if the readings are written to stdout.
+	logOutput := config.LogFilePath
+	if logOutput == "" {
+		logOutput = "stdout"
+		if config.WritesToStdout() {
+			logOutput = "stderr"
+		}
+	}
+	configuredLogger, logCloser, err := simulator.NewLogger(*logLevel, logOutput, *logFormat)
+	if err != nil {
+		fatal(logger, "Error setting up logger", err)
 	}
+	defer logCloser.Close()
+	logger = configuredLogger
 
-	log.Printf("Starting temperature simulator...")
+	logger.Info("Starting temperature simulator")
 
 	sensors := sensorConfig.Sensors
-	log.Printf("Loaded configuration: %+v", config)
-	log.Printf("Loaded %d sensors", len(sensors))
-
-	// Generate temperature readings.
-	log.Println("Generating temperature readings...")
-	data, err := simulator.GenerateTemperatureReadings(
-		sensors,
-		config.TotalReadings,
-		config.StartingTemp,
-		config.MaxTempIncrease,
-		config.TempFluctuation,
-		config.MinTemp,
-		config.MaxTemp,
-		config.Simulate,
-	)
+	logger.Debug("Loaded configuration", "config", config.Redacted())
+	logger.Info("Loaded sensors", "count", len(sensors))
+
+	// Create every configured output sink.
+	sink, err := simulator.NewSinks(config, logger)
 	if err != nil {
-		log.Fatalf("Error generating temperature readings: %v", err)
+		fatal(logger, "Error configuring output sinks", err)
 	}
-	log.Printf("Generated %d temperature readings", len(data))
 
-	// Save generated temperature readings to the output file.
-	log.Printf("Saving temperature readings to %s", config.OutputFileName)
-	if err := simulator.SaveToJSON(data, config.OutputFileName); err != nil {
-		log.Fatalf("Error saving to JSON: %v", err)
+	// In serve mode, also feed the readings to a Prometheus exporter served on /metrics.
+	if *serveAddr != "" {
+		if runMode, err := config.RunMode(); err == nil && runMode == simulator.ModeBackfill {
+			logger.Warn("Serving metrics in backfill mode; readings are produced as fast as possible")
+		}
+		metrics := simulator.NewMetrics(logger)
+		sink = simulator.NewMultiSink(sink, metrics)
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics)
+
+		// Bind the address now, before the sinks truncate any output, so that e.g. a port in use
+		// is reported while nothing needs cleaning up yet.
+		listener, err := net.Listen("tcp", *serveAddr)
+		if err != nil {
+			fatal(logger, "Error listening for metrics requests", err)
+		}
+		logger.Info("Serving metrics", "address", listener.Addr().String(), "path", "/metrics")
+		go func() {
+			if err := http.Serve(listener, mux); err != nil {
+				logger.Error("Error serving metrics", "error", err)
+			}
+		}()
+	}
+
+	// Stop generating on SIGINT or SIGTERM, and stop sinks from waiting to retry failed writes.
+	// A second signal terminates the process immediately.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-ctx.Done()
+		stop()
+		if stopper, ok := sink.(simulator.Stopper); ok {
+			stopper.Stop()
+		}
+	}()
+
+	// Open the sinks before generating anything.
+	if err := sink.Open(); err != nil {
+		fatal(logger, "Error opening output sinks", err)
 	}
 
-	log.Println("Temperature simulation completed successfully.")
+	// Generate temperature readings in the background and write each one as soon as it is produced.
+	logger.Info("Generating temperature readings")
+	generator := &simulator.Generator{
+		Sensors: sensors,
+		Config:  config,
+		Logger:  logger,
+	}
+	started := time.Now()
+	generateCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	readings := make(chan simulator.TemperatureReading, 1024)
+	generateErr := make(chan error, 1)
+	go func() {
+		generateErr <- generator.Stream(generateCtx, readings)
+	}()
+
+	// When interrupted, the generator stops and closes the channel, and every reading produced so far
+	// is still written and flushed before the sinks are closed. The sinks are also closed after a
+	// failed write, e.g. of a sink stopped while retrying, so that the others flush what they buffered.
+	count, writeErr := simulator.WriteAll(sink, readings)
+	if writeErr != nil {
+		cancel()
+	}
+	if err := errors.Join(writeErr, sink.Close()); err != nil {
+		if ctx.Err() != nil {
+			logger.Warn("Temperature simulation interrupted", "readings", count, "elapsed", time.Since(started), "error", err)
+			os.Exit(exitInterrupted)
+		}
+		if writeErr != nil {
+			fatal(logger, "Error writing temperature readings", err)
+		}
+		fatal(logger, "Error closing output sinks", err)
+	}
+	if err := <-generateErr; err != nil {
+		if errors.Is(err, context.Canceled) {
+			logger.Warn("Temperature simulation interrupted", "readings", count, "elapsed", time.Since(started))
+			os.Exit(exitInterrupted)
+		}
+		fatal(logger, "Error generating temperature readings", err)
+	}
+	logger.Info("Temperature simulation completed successfully", "readings", count, "elapsed", time.Since(started))
+
+	// Keep exporting the final temperatures until the process is stopped.
+	if *serveAddr != "" {
+		logger.Info("Generation finished; still serving metrics", "address", *serveAddr, "path", "/metrics")
+		<-ctx.Done()
+		logger.Info("Stopped serving metrics")
+	}
+}
+
+// configFlag is a command-line flag that overrides the configuration setting with the JSON key key.
+type configFlag struct {
+	key    string
+	value  string
+	isBool bool
+}
+
+// String returns the value of the flag.
+func (f *configFlag) String() string {
+	return f.value
+}
+
+// IsBoolFlag reports whether the flag may be given without a value, as in -simulate, which the flag
+// package then sets to "true".
+func (f *configFlag) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Set checks that the value can be assigned to the setting and records it.
+func (f *configFlag) Set(value string) error {
+	var scratch simulator.Config
+	if err := scratch.Set(f.key, value); err != nil {
+		return errors.Unwrap(err) // The flag package already names the flag and value.
+	}
+	f.value = value
+	return nil
+}
+
+// fatal logs the error at error level and exits with a non-zero status.
+func fatal(logger *slog.Logger, msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
 }
@@ -0,0 +1,30 @@
+package simulator
+
+import "time"
+
+// Clock abstracts the passage of time for the simulator.
+// It allows the simulation to be driven by the system clock in production and by a fake clock
+// in tests, so that real-time pacing can be verified without actually waiting.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// After waits for the duration to elapse and then sends the current time on the returned channel.
+	After(d time.Duration) <-chan time.Time
+}
+
+// systemClock implements Clock using the standard time package.
+type systemClock struct{}
+
+// Now returns the current system time.
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// After delegates to time.After.
+func (systemClock) After(d time.Duration) <-chan time.Time {
+	return time.After(d)
+}
+
+// SystemClock is the Clock backed by the real system time. It is used whenever no clock is provided.
+var SystemClock Clock = systemClock{}
@@ -1,72 +1,210 @@
 package simulator
 
 import (
-	"bufio"
 	"encoding/json"
 	"fmt"
-	"log"
+	"io"
+	"log/slog"
 	"os"
 	"strings"
+	"time"
 )
 
-// SetupLogger configures the global logger based on the specified log level and output destination.
-// The log level can be one of: "debug", "info", "warn", "error".
-// The log output can be either "stdout" or a file path specified via command-line or configuration.
+// NewLogger creates a leveled logger that writes to the specified output destination.
+// The log level can be one of: "debug", "info", "warn", "error"; messages below it are discarded.
+// The log output can be "stdout", "stderr" or a file path specified via command-line or configuration.
+// The log format can be "text" for key=value lines or "json" for one JSON object per line.
 //
 // Parameters:
-//   - logLevel: The desired log level for the application.
-//   - logOutput: The destination for the logs, either "stdout" or a file path.
+//   - logLevel: The minimum level of the messages that are logged.
+//   - logOutput: The destination for the logs, either "stdout", "stderr" or a file path.
+//   - logFormat: The format of the log records, either "text" or "json".
 //
 // Returns:
-//   - An error if the log level or log output is invalid, or nil if successful.
-func SetupLogger(logLevel, logOutput string) error {
-	// Determine the log output destination (stdout or a file).
-	var output *os.File
-	if logOutput == "stdout" {
+//   - The logger, and a closer that closes the log file, if any, which the caller must call once the
+//     logger is no longer used; or an error if the log level, output or format is invalid.
+func NewLogger(logLevel, logOutput, logFormat string) (*slog.Logger, io.Closer, error) {
+	level, err := ParseLogLevel(logLevel)
+	if err != nil {
+		return nil, nil, err
+	}
+	format := strings.ToLower(logFormat)
+	if format != "text" && format != "json" && format != "" {
+		return nil, nil, fmt.Errorf("unknown log format: %s", logFormat)
+	}
+
+	// Determine the log output destination (stdout, stderr or a file).
+	var output io.Writer
+	var closer io.Closer = nopCloser{}
+	switch logOutput {
+	case "stdout", "":
 		output = os.Stdout
-	} else {
+	case "stderr":
+		output = os.Stderr
+	default:
 		// Open or create the log file.
-		var err error
-		output, err = os.OpenFile(logOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+		file, err := os.OpenFile(logOutput, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
 		if err != nil {
-			return fmt.Errorf("unable to open log file: %w", err)
+			return nil, nil, fmt.Errorf("unable to open log file: %w", err)
 		}
+		output, closer = file, file
 	}
 
-	log.SetOutput(output)
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile) // Add timestamp and file info to logs.
+	options := &slog.HandlerOptions{Level: level}
+	var handler slog.Handler
+	if format == "json" {
+		handler = slog.NewJSONHandler(output, options)
+	} else {
+		handler = slog.NewTextHandler(output, options)
+	}
+
+	logger := slog.New(handler)
+	logger.Debug("Logger initialized", "level", level, "output", logOutput, "format", logFormat)
+	return logger, closer, nil
+}
 
-	// Set the log level.
+// nopCloser is the closer of loggers writing to standard output or standard error, which stay open.
+type nopCloser struct{}
+
+// Close does nothing.
+func (nopCloser) Close() error {
+	return nil
+}
+
+// ParseLogLevel converts a log level name ("debug", "info", "warn" or "error") to a slog level.
+func ParseLogLevel(logLevel string) (slog.Level, error) {
 	switch strings.ToLower(logLevel) {
 	case "debug":
-		log.SetPrefix("DEBUG: ")
+		return slog.LevelDebug, nil
 	case "info":
-		log.SetPrefix("INFO: ")
-	case "warn":
-		log.SetPrefix("WARN: ")
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
 	case "error":
-		log.SetPrefix("ERROR: ")
+		return slog.LevelError, nil
 	default:
-		return fmt.Errorf("unknown log level: %s", logLevel)
+		return 0, fmt.Errorf("unknown log level: %s", logLevel)
 	}
+}
 
-	log.Printf("Logger initialized with level: %s, output: %s", logLevel, logOutput)
-	return nil
+// loggerOrDefault returns the logger, or the default logger if it is nil.
+func loggerOrDefault(logger *slog.Logger) *slog.Logger {
+	if logger == nil {
+		return slog.Default()
+	}
+	return logger
 }
 
 // Config holds the configuration settings for the temperature simulation, including log file path.
 // This struct defines the core parameters for running the simulation, such as the number of readings,
 // initial temperature, temperature fluctuations, and the simulation mode.
 type Config struct {
-	TotalReadings   int     `json:"totalReadings"`   // Number of temperature readings to generate.
-	StartingTemp    float64 `json:"startingTemp"`    // Initial temperature for all sensors at the start of the simulation.
-	MaxTempIncrease float64 `json:"maxTempIncrease"` // Maximum temperature increase allowed during the increase period.
-	TempFluctuation float64 `json:"tempFluctuation"` // The maximum random fluctuation to be applied to the temperature.
-	MinTemp         float64 `json:"minTemp"`         // The minimum allowable temperature value.
-	MaxTemp         float64 `json:"maxTemp"`         // The maximum allowable temperature value.
-	OutputFileName  string  `json:"outputFileName"`  // Name of the file where simulation results will be saved.
-	Simulate        bool    `json:"simulate"`        // If true, the simulation runs over real time; otherwise, it runs as fast as possible.
-	LogFilePath     string  `json:"logFilePath"`     // Path to the log file, if not provided via command-line.
+	TotalReadings   int          `json:"totalReadings"`          // Number of readings per sensor; 0 runs until Duration, Until or cancellation.
+	Duration        Duration     `json:"duration,omitempty"`     // Length of the run in simulated time; 0 means no limit.
+	Until           string       `json:"until,omitempty"`        // RFC 3339 timestamp of simulated time at which the run ends; empty means no limit.
+	StartingTemp    float64      `json:"startingTemp"`           // Initial temperature for all sensors at the start of the simulation.
+	MaxTempIncrease float64      `json:"maxTempIncrease"`        // Maximum temperature increase allowed during the increase period.
+	TempFluctuation float64      `json:"tempFluctuation"`        // The maximum random fluctuation to be applied to the temperature.
+	MinTemp         float64      `json:"minTemp"`                // The minimum allowable temperature value.
+	MaxTemp         float64      `json:"maxTemp"`                // The maximum allowable temperature value.
+	OutputFileName  string       `json:"outputFileName"`         // Name of the file where simulation results will be saved.
+	Mode            RunMode      `json:"mode,omitempty"`         // How readings are paced: "backfill", "realtime" or "accelerated".
+	TimeScale       float64      `json:"timeScale,omitempty"`    // Speed of simulated time relative to the clock in accelerated mode; defaults to 60.
+	Simulate        bool         `json:"simulate"`               // Deprecated: use Mode. True selects backfill and false real time when Mode is empty.
+	LogFilePath     string       `json:"logFilePath"`            // Path to the log file, if not provided via command-line.
+	Seed            int64        `json:"seed"`                   // Seed for the random number generator; 0 picks a time-based seed.
+	StartTime       string       `json:"startTime"`              // RFC 3339 timestamp at which a simulated run starts; empty means now.
+	Interval        Duration     `json:"interval"`               // Time between two readings of a sensor; defaults to one minute.
+	Sinks           []SinkConfig `json:"sinks,omitempty"`        // Output destinations; defaults to a single file sink at OutputFileName.
+	OutputFormat    string       `json:"outputFormat"`           // Format of file and stdout output, "json", "csv" or "line"; empty picks it from the file extension.
+	CSVColumns      []string     `json:"csvColumns,omitempty"`   // Columns of CSV output, in order; defaults to all columns.
+	CSVDelimiter    string       `json:"csvDelimiter,omitempty"` // Single-character field delimiter of CSV output; defaults to a comma.
+}
+
+// RunMode selects how the generator paces the readings it produces.
+type RunMode string
+
+// Run modes supported by the generator.
+const (
+	// ModeBackfill produces every reading immediately, with timestamps spaced by the reading interval.
+	ModeBackfill RunMode = "backfill"
+
+	// ModeRealtime waits on the clock until each reading is due and stamps it with the current time.
+	ModeRealtime RunMode = "realtime"
+
+	// ModeAccelerated waits on the clock like ModeRealtime, but simulated time advances TimeScale
+	// times faster than the clock, and readings are stamped with their simulated time.
+	ModeAccelerated RunMode = "accelerated"
+)
+
+// RunMode returns the run mode of the simulation. When Mode is empty, the deprecated Simulate flag
+// selects it: true maps to ModeBackfill and false to ModeRealtime, which is how the flag has always
+// behaved despite its name.
+//
+// Returns an error if Mode is not one of the supported run modes.
+func (c Config) RunMode() (RunMode, error) {
+	switch mode := RunMode(strings.ToLower(string(c.Mode))); mode {
+	case "":
+		if c.Simulate {
+			return ModeBackfill, nil
+		}
+		return ModeRealtime, nil
+	case ModeBackfill, ModeRealtime, ModeAccelerated:
+		return mode, nil
+	default:
+		return "", fmt.Errorf("unknown run mode: %s", c.Mode)
+	}
+}
+
+// unbounded reports whether a run with this configuration only ends when it is cancelled.
+func (c Config) unbounded() bool {
+	return c.TotalReadings == 0 && c.Duration == 0 && c.Until == ""
+}
+
+// WritesToStdout reports whether any sink writes readings to standard output, which logs must then
+// stay away from for the readings to remain machine-readable.
+func (c Config) WritesToStdout() bool {
+	if len(c.Sinks) == 0 {
+		return c.OutputFileName == "stdout"
+	}
+	for _, sinkConfig := range c.Sinks {
+		switch sinkConfig.Type {
+		case "stdout":
+			return true
+		case "file", "":
+			path := sinkConfig.Path
+			if path == "" {
+				path = c.OutputFileName
+			}
+			if path == "stdout" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redacted replaces the secrets that a printed configuration must not reveal.
+const redacted = "REDACTED"
+
+// Redacted returns a copy of the configuration whose sink tokens and passwords, if set, are
+// replaced, so that it can be printed or logged.
+func (c Config) Redacted() Config {
+	if len(c.Sinks) == 0 {
+		return c
+	}
+	sinks := make([]SinkConfig, len(c.Sinks))
+	for i, sinkConfig := range c.Sinks {
+		if sinkConfig.Token != "" {
+			sinkConfig.Token = redacted
+		}
+		if sinkConfig.Password != "" {
+			sinkConfig.Password = redacted
+		}
+		sinks[i] = sinkConfig
+	}
+	c.Sinks = sinks
+	return c
 }
 
 // Sensor holds metadata information about a specific sensor used in the simulation.
@@ -76,60 +214,147 @@ type Sensor struct {
 	ID       string `json:"id"`       // Unique identifier for the sensor.
 	Version  string `json:"version"`  // Version information about the sensor.
 	Location string `json:"location"` // Physical location or placement of the sensor.
+
+	Interval Duration `json:"interval,omitempty"` // Time between two readings, overriding the global interval.
+
+	// Simulation parameters overriding the global ones of Config for this sensor, so that e.g. a
+	// freezer and a furnace can be simulated in the same run. Nil uses the global value.
+	StartingTemp    *float64 `json:"startingTemp,omitempty"`
+	MaxTempIncrease *float64 `json:"maxTempIncrease,omitempty"`
+	TempFluctuation *float64 `json:"tempFluctuation,omitempty"`
+	MinTemp         *float64 `json:"minTemp,omitempty"`
+	MaxTemp         *float64 `json:"maxTemp,omitempty"`
+
+	Model *ModelSpec `json:"model,omitempty"` // Model producing the temperatures; defaults to the sawtooth model.
+
+	Faults []FaultSpec `json:"faults,omitempty"` // Faults injected into the readings after the model, see FaultSpec.
+}
+
+// SensorParams holds the simulation parameters of a single sensor.
+type SensorParams struct {
+	StartingTemp    float64 // Initial temperature of the sensor.
+	MaxTempIncrease float64 // Temperature increase during each increase period.
+	TempFluctuation float64 // Maximum random fluctuation applied to each reading.
+	MinTemp         float64 // Minimum temperature of the sensor.
+	MaxTemp         float64 // Maximum temperature of the sensor.
+}
+
+// Params returns the simulation parameters of the sensor, taking each one that the sensor does not
+// override from the global configuration.
+func (s Sensor) Params(config Config) SensorParams {
+	resolve := func(override *float64, global float64) float64 {
+		if override != nil {
+			return *override
+		}
+		return global
+	}
+	return SensorParams{
+		StartingTemp:    resolve(s.StartingTemp, config.StartingTemp),
+		MaxTempIncrease: resolve(s.MaxTempIncrease, config.MaxTempIncrease),
+		TempFluctuation: resolve(s.TempFluctuation, config.TempFluctuation),
+		MinTemp:         resolve(s.MinTemp, config.MinTemp),
+		MaxTemp:         resolve(s.MaxTemp, config.MaxTemp),
+	}
+}
+
+// Duration is a time.Duration that is encoded in JSON as a duration string such as "250ms", "10s" or "15m".
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string in the format produced by time.Duration.String.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON parses a duration string such as "250ms", "10s" or "15m".
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"10s\": %w", err)
+	}
+	parsed, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(parsed)
+	return nil
 }
 
 // SensorConfig represents the complete configuration for the simulation.
 // It includes the global simulation configuration and a list of sensors that will
 // generate temperature readings.
 type SensorConfig struct {
-	Config  Config   `json:"config"`  // Global simulation configuration settings.
-	Sensors []Sensor `json:"sensors"` // List of sensors to simulate.
+	Config       Config        `json:"config"`                 // Global simulation configuration settings.
+	Sensors      []Sensor      `json:"sensors"`                // List of sensors to simulate.
+	SensorGroups []SensorGroup `json:"sensorGroups,omitempty"` // Groups of similar sensors, expanded into Sensors on loading.
+
+	// origins holds, for each sensor expanded from a group, where it was configured, e.g.
+	// "sensorGroups[1] (n=7)", and "" for sensors listed in the sensors array.
+	origins []string
+}
+
+// LoadOptions controls how a configuration file is decoded.
+type LoadOptions struct {
+	// AllowUnknownFields makes keys that match no setting warnings instead of errors, for
+	// configuration files shared with newer or older versions of the simulator.
+	AllowUnknownFields bool
 }
 
-// LoadConfigAndSensors loads the simulation configuration and sensor metadata from a JSON file.
-// It reads the configuration file, decodes it into a SensorConfig struct, and returns the struct.
+// LoadConfigAndSensors loads the simulation configuration and sensor metadata from a JSON, YAML or
+// TOML file. It reads the configuration file, decodes it into a SensorConfig struct, and returns the
+// struct. The format is picked by extension: .yaml and .yml files are YAML, .toml files are TOML and
+// every other file is JSON. All formats use the same keys, e.g. "maxTemp" and "sensors".
 //
 // Parameters:
 //   - filename: The path to the configuration file containing the simulation and sensor settings.
+//   - logger: The logger for progress and error messages; nil uses the default logger.
+//   - options: How the file is decoded; the zero value rejects unknown keys.
 //
 // Returns:
 //   - A pointer to a SensorConfig struct populated with the configuration and sensors.
-//   - An error if the file cannot be opened or if the JSON is invalid.
+//   - An error if the file cannot be opened or if its contents are invalid.
+//
+// Decoding is strict: a key that matches no setting, such as a misspelled "maxTemprature", and any
+// data after the top-level object are errors. Decoding errors report the line and column at which
+// they occurred, except for keys and values in TOML files, which are reported by path only.
 //
-// This function uses buffered reading for efficiency, especially with larger configuration files.
-// It will return an error if no sensors are found in the configuration or if the JSON format is incorrect.
-func LoadConfigAndSensors(filename string) (*SensorConfig, error) {
-	// Open the configuration file for reading.
-	file, err := os.Open(filename)
+// Sensor groups are expanded into concrete sensors, see SensorConfig.ExpandSensorGroups. It will
+// also return an error if no sensors are found in the configuration.
+func LoadConfigAndSensors(filename string, logger *slog.Logger, options LoadOptions) (*SensorConfig, error) {
+	logger = loggerOrDefault(logger)
+
+	// Read the whole configuration file, so that errors can be located by line and column.
+	data, err := os.ReadFile(filename)
 	if err != nil {
-		log.Printf("Error opening configuration file: %v", err)
+		logger.Error("Error opening configuration file", "error", err)
 		return nil, fmt.Errorf("unable to open configuration file: %w", err)
 	}
-	defer func() {
-		if err := file.Close(); err != nil {
-			log.Printf("Error closing configuration file: %v", err)
-		}
-	}()
-
-	// Use a buffered reader for efficient reading of the file contents.
-	reader := bufio.NewReader(file)
 
-	// Decode the JSON configuration into a SensorConfig struct.
+	// Decode the configuration into a SensorConfig struct.
 	var sensorConfig SensorConfig
-	decoder := json.NewDecoder(reader)
-	if err := decoder.Decode(&sensorConfig); err != nil {
-		log.Printf("Error decoding JSON configuration: %v", err)
-		return nil, fmt.Errorf("error decoding configuration JSON: %w", err)
+	format := configFormat(filename)
+	unknown, err := decodeConfig(data, format, &sensorConfig, options.AllowUnknownFields)
+	if err != nil {
+		logger.Error("Error decoding configuration", "file", filename, "format", format, "error", err)
+		return nil, fmt.Errorf("error decoding configuration %s: %s: %w", strings.ToUpper(format), filename, err)
+	}
+	for _, message := range unknown {
+		logger.Warn("Ignoring unknown configuration field", "file", filename, "detail", message)
+	}
+
+	// Expand sensor groups into concrete sensors, after the ones listed individually.
+	if err := sensorConfig.ExpandSensorGroups(); err != nil {
+		logger.Error("Error expanding sensor groups", "file", filename, "error", err)
+		return nil, fmt.Errorf("error expanding sensor groups: %s: %w", filename, err)
 	}
 
 	// Ensure that at least one sensor is defined in the configuration.
 	if len(sensorConfig.Sensors) == 0 {
-		log.Printf("No sensors found in configuration")
+		logger.Error("No sensors found in configuration")
 		return nil, fmt.Errorf("no sensors found in configuration")
 	}
 
 	// Log a message after loading the sensors successfully
-	log.Printf("Loaded %d sensors from configuration", len(sensorConfig.Sensors))
+	logger.Info("Loaded sensors from configuration", "count", len(sensorConfig.Sensors))
 
 	return &sensorConfig, nil
 }
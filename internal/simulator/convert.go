@@ -0,0 +1,197 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// yamlToJSON converts a YAML configuration document to JSON, keeping the order of keys. Anchors,
+// aliases and "<<" merge keys are resolved.
+//
+// It also returns the line and column at which each key and sequence item was written, by JSON path
+// (e.g. "sensors[1].location"), so that errors found in the JSON can be reported against the YAML.
+func yamlToJSON(data []byte) ([]byte, map[string]string, error) {
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	var document yaml.Node
+	if err := decoder.Decode(&document); err != nil {
+		if err == io.EOF {
+			return nil, nil, errors.New("the configuration is empty")
+		}
+		return nil, nil, err
+	}
+
+	// A configuration file holds a single document.
+	var next yaml.Node
+	if err := decoder.Decode(&next); err != io.EOF {
+		if err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, fmt.Errorf("line %d, column %d: unexpected data after the end of the configuration", next.Line, next.Column)
+	}
+
+	converter := &yamlConverter{positions: make(map[string]string)}
+	if err := converter.convert(&document, ""); err != nil {
+		return nil, nil, err
+	}
+	return converter.buffer.Bytes(), converter.positions, nil
+}
+
+// yamlConverter writes YAML nodes as JSON and records where each value came from.
+type yamlConverter struct {
+	buffer    bytes.Buffer
+	positions map[string]string
+}
+
+// yamlPair is a key and its value in a YAML mapping.
+type yamlPair struct {
+	key   *yaml.Node
+	value *yaml.Node
+}
+
+// convert writes the JSON form of node, found at the given JSON path.
+func (c *yamlConverter) convert(node *yaml.Node, path string) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		if len(node.Content) == 0 {
+			return errors.New("the configuration is empty")
+		}
+		return c.convert(node.Content[0], path)
+
+	case yaml.AliasNode:
+		return c.convert(node.Alias, path)
+
+	case yaml.MappingNode:
+		pairs, err := mappingPairs(node)
+		if err != nil {
+			return err
+		}
+		c.buffer.WriteByte('{')
+		for i, pair := range pairs {
+			if i > 0 {
+				c.buffer.WriteByte(',')
+			}
+			key, _ := json.Marshal(pair.key.Value)
+			c.buffer.Write(key)
+			c.buffer.WriteByte(':')
+
+			keyPath := pair.key.Value
+			if path != "" {
+				keyPath = path + "." + pair.key.Value
+			}
+			c.positions[keyPath] = fmt.Sprintf("line %d, column %d", pair.key.Line, pair.key.Column)
+			if err := c.convert(pair.value, keyPath); err != nil {
+				return err
+			}
+		}
+		c.buffer.WriteByte('}')
+		return nil
+
+	case yaml.SequenceNode:
+		c.buffer.WriteByte('[')
+		for i, item := range node.Content {
+			if i > 0 {
+				c.buffer.WriteByte(',')
+			}
+			itemPath := fmt.Sprintf("%s[%d]", path, i)
+			c.positions[itemPath] = fmt.Sprintf("line %d, column %d", item.Line, item.Column)
+			if err := c.convert(item, itemPath); err != nil {
+				return err
+			}
+		}
+		c.buffer.WriteByte(']')
+		return nil
+
+	case yaml.ScalarNode:
+		// Let the YAML decoder resolve the scalar's type, so that e.g. 42 is a number, "42" is a string
+		// and an unquoted timestamp becomes an RFC 3339 string.
+		var value any
+		if err := node.Decode(&value); err != nil {
+			return err
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("line %d, column %d: cannot use %s in the configuration: %w", node.Line, node.Column, node.Value, err)
+		}
+		c.buffer.Write(encoded)
+		return nil
+	}
+	return fmt.Errorf("line %d, column %d: unsupported YAML node", node.Line, node.Column)
+}
+
+// mappingPairs returns the keys and values of a YAML mapping, with the pairs of "<<" merge keys
+// inlined. Keys written in the mapping itself take precedence over merged ones, as do earlier merged
+// mappings over later ones.
+func mappingPairs(node *yaml.Node) ([]yamlPair, error) {
+	var explicit, merged []yamlPair
+	written := make(map[string]*yaml.Node)
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.Kind != yaml.ScalarNode {
+			return nil, fmt.Errorf("line %d, column %d: mapping keys must be strings", key.Line, key.Column)
+		}
+		if key.Tag != "!!merge" {
+			if first, ok := written[key.Value]; ok {
+				return nil, fmt.Errorf("line %d, column %d: key %q is already set on line %d", key.Line, key.Column, key.Value, first.Line)
+			}
+			written[key.Value] = key
+			explicit = append(explicit, yamlPair{key, value})
+			continue
+		}
+
+		sources := []*yaml.Node{value}
+		if resolveAlias(value).Kind == yaml.SequenceNode {
+			sources = resolveAlias(value).Content
+		}
+		for _, source := range sources {
+			source = resolveAlias(source)
+			if source.Kind != yaml.MappingNode {
+				return nil, fmt.Errorf("line %d, column %d: merge key requires a mapping", source.Line, source.Column)
+			}
+			pairs, err := mappingPairs(source)
+			if err != nil {
+				return nil, err
+			}
+			merged = append(merged, pairs...)
+		}
+	}
+
+	seen := make(map[string]bool, len(explicit)+len(merged))
+	pairs := make([]yamlPair, 0, len(explicit)+len(merged))
+	for _, pair := range append(explicit, merged...) {
+		if !seen[pair.key.Value] {
+			seen[pair.key.Value] = true
+			pairs = append(pairs, pair)
+		}
+	}
+	return pairs, nil
+}
+
+// resolveAlias returns the node that an alias refers to, or the node itself if it is no alias.
+func resolveAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	return node
+}
+
+// tomlToJSON converts a TOML configuration document to JSON. TOML tables become objects, arrays of
+// tables become arrays of objects and date-times become RFC 3339 strings.
+//
+// The TOML decoder does not record where keys were written, so only syntax errors carry a line.
+func tomlToJSON(data []byte) ([]byte, error) {
+	var document map[string]any
+	if _, err := toml.Decode(string(data), &document); err != nil {
+		return nil, err
+	}
+	converted, err := json.Marshal(document)
+	if err != nil {
+		return nil, fmt.Errorf("cannot use the configuration: %w", err)
+	}
+	return converted, nil
+}
@@ -0,0 +1,180 @@
+package simulator
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"unicode/utf8"
+)
+
+// DefaultCSVColumns lists the columns written to CSV output when none are configured.
+var DefaultCSVColumns = []string{
+	"time",
+	"temperature",
+	"sensor.name",
+	"sensor.id",
+	"sensor.version",
+	"sensor.location",
+	"seed",
+	"fault",
+}
+
+// csvFields maps each supported CSV column name to the function extracting its value from a reading.
+// Sensor fields are flattened into "sensor.<field>" columns.
+var csvFields = map[string]func(TemperatureReading) string{
+	"time":            func(r TemperatureReading) string { return r.Time },
+	"temperature":     func(r TemperatureReading) string { return strconv.FormatFloat(float64(r.Temperature), 'f', 2, 64) },
+	"sensor.name":     func(r TemperatureReading) string { return r.Sensor.Name },
+	"sensor.id":       func(r TemperatureReading) string { return r.Sensor.ID },
+	"sensor.version":  func(r TemperatureReading) string { return r.Sensor.Version },
+	"sensor.location": func(r TemperatureReading) string { return r.Sensor.Location },
+	"seed":            func(r TemperatureReading) string { return strconv.FormatInt(r.Seed, 10) },
+	"fault":           func(r TemperatureReading) string { return r.Fault },
+}
+
+// parseDelimiter converts a configured delimiter to a rune, defaulting to a comma. Like encoding/csv,
+// it rejects quotes, line breaks, null characters and invalid UTF-8, which the CSV writer would only
+// refuse when the sink is opened.
+func parseDelimiter(delimiter string) (rune, error) {
+	if delimiter == "" {
+		return ',', nil
+	}
+	if utf8.RuneCountInString(delimiter) != 1 {
+		return 0, fmt.Errorf("CSV delimiter must be a single character, got %q", delimiter)
+	}
+	r, _ := utf8.DecodeRuneInString(delimiter)
+	switch r {
+	case 0, '"', '\r', '\n', utf8.RuneError:
+		return 0, fmt.Errorf("CSV delimiter must not be a quote, line break, null or invalid character, got %q", delimiter)
+	}
+	return r, nil
+}
+
+// csvColumnFields resolves the functions extracting the given columns from a reading.
+// Returns an error naming the first unknown column.
+func csvColumnFields(columns []string) ([]func(TemperatureReading) string, error) {
+	fields := make([]func(TemperatureReading) string, len(columns))
+	for i, column := range columns {
+		field, ok := csvFields[column]
+		if !ok {
+			return nil, fmt.Errorf("unknown CSV column: %s", column)
+		}
+		fields[i] = field
+	}
+	return fields, nil
+}
+
+// CSVSink writes readings as CSV with a header row to a file, or to standard output when the path
+// is "stdout". Sensor metadata is flattened into "sensor.name", "sensor.id", "sensor.version" and
+// "sensor.location" columns.
+type CSVSink struct {
+	Path      string   // Path of the output file, or "stdout".
+	Columns   []string // Columns to write, in order; defaults to DefaultCSVColumns.
+	Delimiter rune     // Field delimiter; defaults to a comma.
+
+	file   *os.File
+	writer *csv.Writer
+	fields []func(TemperatureReading) string
+	record []string
+}
+
+// Open validates the columns, creates the output file and writes the header row.
+func (s *CSVSink) Open() error {
+	if len(s.Columns) == 0 {
+		s.Columns = DefaultCSVColumns
+	}
+	if s.Delimiter == 0 {
+		s.Delimiter = ','
+	}
+
+	// Resolve every column before creating the file, so a typo does not truncate existing output.
+	fields, err := csvColumnFields(s.Columns)
+	if err != nil {
+		return err
+	}
+	s.fields = fields
+	s.record = make([]string, len(s.Columns))
+
+	output := os.Stdout
+	if s.Path != "stdout" {
+		file, err := os.Create(s.Path)
+		if err != nil {
+			return fmt.Errorf("error creating CSV file: %w", err)
+		}
+		s.file = file
+		output = file
+	}
+
+	s.writer = csv.NewWriter(output)
+	s.writer.Comma = s.Delimiter
+	if err := s.writer.Write(s.Columns); err != nil {
+		return fmt.Errorf("error writing CSV header: %w", err)
+	}
+	return nil
+}
+
+// Write appends the reading to the output as a CSV record.
+func (s *CSVSink) Write(reading TemperatureReading) error {
+	for i, field := range s.fields {
+		s.record[i] = field(reading)
+	}
+	if err := s.writer.Write(s.record); err != nil {
+		return fmt.Errorf("error writing CSV record: %w", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered records to the output.
+func (s *CSVSink) Flush() error {
+	s.writer.Flush()
+	if err := s.writer.Error(); err != nil {
+		return fmt.Errorf("error flushing CSV data: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the buffered records and closes the output file.
+func (s *CSVSink) Close() error {
+	err := s.Flush()
+	if s.file != nil {
+		if cerr := s.file.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing CSV file: %w", cerr))
+		}
+	}
+	return err
+}
+
+// SaveToCSV writes the temperature readings to a CSV file with a header row.
+//
+// Parameters:
+//   - data: The temperature readings to write.
+//   - filename: The name of the file to save the readings to.
+//   - columns: The columns to write, in order; nil selects DefaultCSVColumns.
+//   - delimiter: The field delimiter; 0 selects a comma.
+//   - logger: The logger for progress messages; nil uses the default logger.
+//
+// Returns an error if a column is unknown or the file cannot be created or written to.
+func SaveToCSV(data []TemperatureReading, filename string, columns []string, delimiter rune, logger *slog.Logger) error {
+	logger = loggerOrDefault(logger)
+	logger.Info("Saving data to CSV file", "file", filename)
+	sink := &CSVSink{Path: filename, Columns: columns, Delimiter: delimiter}
+	if err := sink.Open(); err != nil {
+		return err
+	}
+
+	for _, reading := range data {
+		if err := sink.Write(reading); err != nil {
+			_ = sink.Close()
+			return err
+		}
+	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
+
+	logger.Info("Data successfully saved", "file", filename)
+	return nil
+}
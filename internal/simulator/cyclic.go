@@ -0,0 +1,69 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// cyclicParams holds the parameters of the cyclic model.
+type cyclicParams struct {
+	Mean              *float64 `json:"mean,omitempty"`    // Temperature around which the cycles swing; defaults to the starting temperature.
+	DailyAmplitude    float64  `json:"dailyAmplitude"`    // How far the daily cycle swings above and below the mean.
+	PeakHour          float64  `json:"peakHour"`          // Hour of the day of the daily maximum, e.g. 14.5; defaults to 15.
+	SeasonalAmplitude float64  `json:"seasonalAmplitude"` // How far the seasonal cycle swings above and below the mean.
+	PeakDay           float64  `json:"peakDay"`           // Day of the year of the seasonal maximum, 1 to 366; defaults to 200.
+	Timezone          string   `json:"timezone"`          // IANA time zone in which hours and days are counted; defaults to UTC.
+}
+
+// cyclicModel follows a daily and a seasonal cosine curve of the simulated time, each peaking at a
+// configurable point, with uniform random fluctuation of up to TempFluctuation around the curve.
+// Unlike the sawtooth model it does not build on the previous temperature.
+type cyclicModel struct {
+	params   cyclicParams
+	location *time.Location
+}
+
+// newCyclicModel creates a cyclic model from its parameters.
+func newCyclicModel(params json.RawMessage) (Model, error) {
+	p := cyclicParams{PeakHour: 15, PeakDay: 200}
+	if err := decodeModelParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.DailyAmplitude < 0:
+		return nil, fmt.Errorf("dailyAmplitude must not be negative, got %g", p.DailyAmplitude)
+	case p.SeasonalAmplitude < 0:
+		return nil, fmt.Errorf("seasonalAmplitude must not be negative, got %g", p.SeasonalAmplitude)
+	case p.PeakHour < 0 || p.PeakHour >= 24:
+		return nil, fmt.Errorf("peakHour must be at least 0 and less than 24, got %g", p.PeakHour)
+	case p.PeakDay < 1 || p.PeakDay > 366:
+		return nil, fmt.Errorf("peakDay must be between 1 and 366, got %g", p.PeakDay)
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", p.Timezone, err)
+	}
+	return &cyclicModel{params: p, location: location}, nil
+}
+
+// Next returns the value of both curves at the time of the reading, plus the fluctuation.
+func (m *cyclicModel) Next(state ModelState, r *rand.Rand) float64 {
+	mean := state.Params.StartingTemp
+	if m.params.Mean != nil {
+		mean = *m.params.Mean
+	}
+
+	// Count hours and days on the wall clock of the configured time zone.
+	local := state.Time.In(m.location)
+	hour := float64(local.Hour()) + float64(local.Minute())/60 + float64(local.Second())/3600
+	day := float64(local.YearDay()-1) + hour/24
+	daysInYear := float64(time.Date(local.Year(), time.December, 31, 0, 0, 0, 0, m.location).YearDay())
+
+	daily := m.params.DailyAmplitude * math.Cos(2*math.Pi*(hour-m.params.PeakHour)/24)
+	seasonal := m.params.SeasonalAmplitude * math.Cos(2*math.Pi*(day-(m.params.PeakDay-1))/daysInYear)
+	fluctuation := r.Float64()*2*state.Params.TempFluctuation - state.Params.TempFluctuation
+	return mean + daily + seasonal + fluctuation
+}
@@ -0,0 +1,324 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"reflect"
+	"strings"
+)
+
+// unknownField is an object key in a configuration file that matches no configuration setting.
+type unknownField struct {
+	path   string // JSON path of the key, e.g. "config.maxTemprature".
+	offset int64  // Byte offset of the key in the file.
+}
+
+// jsonUnmarshalerType is the type of json.Unmarshaler, whose implementations decode themselves.
+var jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+
+// Configuration file formats, picked by file extension.
+const (
+	configFormatJSON = "json"
+	configFormatYAML = "yaml"
+	configFormatTOML = "toml"
+)
+
+// configFormat picks the format of a configuration file from its extension: .yaml and .yml files
+// are YAML, .toml files are TOML and every other file is JSON.
+func configFormat(filename string) string {
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".yaml", ".yml":
+		return configFormatYAML
+	case ".toml":
+		return configFormatTOML
+	default:
+		return configFormatJSON
+	}
+}
+
+// locator describes where in a configuration file the value at a JSON path, or at a byte offset of
+// the JSON document, was written, as "line 3, column 5". It returns "" if the position is unknown.
+type locator func(path string, offset int64) string
+
+// decodeConfig decodes a configuration document in the given format into v, which must be a pointer.
+// YAML and TOML documents are converted to JSON first, so that every format maps onto the same
+// structs, with the same field names and the same checks.
+//
+// Object keys that match no field of v are reported as an error, or returned for the caller to log
+// when allowUnknownFields is set. Errors carry the line and column at which they occurred wherever
+// the format allows it.
+func decodeConfig(data []byte, format string, v any, allowUnknownFields bool) ([]string, error) {
+	switch format {
+	case configFormatYAML:
+		converted, positions, err := yamlToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return decodeJSONConfig(converted, v, allowUnknownFields, func(path string, _ int64) string {
+			return positions[path]
+		})
+	case configFormatTOML:
+		converted, err := tomlToJSON(data)
+		if err != nil {
+			return nil, err
+		}
+		return decodeJSONConfig(converted, v, allowUnknownFields, func(string, int64) string { return "" })
+	default:
+		return decodeJSONConfig(data, v, allowUnknownFields, func(_ string, offset int64) string {
+			line, column := position(data, offset)
+			return fmt.Sprintf("line %d, column %d", line, column)
+		})
+	}
+}
+
+// decodeJSONConfig decodes a JSON configuration document into v, which must be a pointer.
+// The document must contain a single value; anything but whitespace after it is an error.
+//
+// Object keys that match no field of v are reported, located by locate, as an error, or returned for
+// the caller to log when allowUnknownFields is set. Syntax and type errors are located as well.
+func decodeJSONConfig(data []byte, v any, allowUnknownFields bool, locate locator) ([]string, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	if err := decoder.Decode(v); err != nil {
+		return nil, describeJSONError(data, err, locate)
+	}
+
+	// Detect trailing data, such as a second object or a stray closing brace.
+	offset := decoder.InputOffset()
+	if _, err := decoder.Token(); err != io.EOF {
+		return nil, errors.New(located(locate("", skipSpace(data, offset)), "unexpected data after the end of the configuration"))
+	}
+
+	unknown, err := findUnknownFields(data, reflect.TypeOf(v))
+	if err != nil {
+		return nil, describeJSONError(data, err, locate)
+	}
+	messages := make([]string, len(unknown))
+	for i, field := range unknown {
+		messages[i] = located(locate(field.path, field.offset), "unknown field "+field.path)
+	}
+	if len(messages) > 0 && !allowUnknownFields {
+		return nil, errors.New(strings.Join(messages, "; "))
+	}
+	return messages, nil
+}
+
+// located prefixes a message with its location, if known.
+func located(location, message string) string {
+	if location == "" {
+		return message
+	}
+	return location + ": " + message
+}
+
+// describeJSONError adds the location at which a decoding error occurred to its message.
+func describeJSONError(data []byte, err error, locate locator) error {
+	var syntaxErr *json.SyntaxError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &syntaxErr):
+		if location := locate("", max(syntaxErr.Offset-1, 0)); location != "" {
+			return fmt.Errorf("%s: %w", location, err)
+		}
+		return err
+	case errors.As(err, &typeErr):
+		// The field of a type error has no array indices, or not in the form of the paths used
+		// elsewhere, so the path is worked out from the offset of the value instead.
+		offset := max(typeErr.Offset-1, 0)
+		path := jsonPathAt(data, offset)
+		if path == "" {
+			path = typeErr.Field
+		}
+		message := fmt.Sprintf("cannot use %s as %s for %s", typeErr.Value, typeErr.Type, path)
+		return fmt.Errorf("%s: %w", located(locate(path, offset), message), err)
+	case errors.Is(err, io.ErrUnexpectedEOF), errors.Is(err, io.EOF):
+		return fmt.Errorf("%s: %w", located(locate("", int64(len(data))), "unexpected end of the configuration"), err)
+	}
+	return err
+}
+
+// jsonPathAt returns the JSON path, e.g. "sensors[1].maxTemp", of the innermost value of a JSON
+// document that contains the byte at offset, or "" if there is none.
+func jsonPathAt(data []byte, offset int64) string {
+	path, _ := valuePathAt(json.NewDecoder(bytes.NewReader(data)), data, offset, "")
+	return path
+}
+
+// valuePathAt reads one value, found at path, and reports whether it contains the byte at offset,
+// returning the path of the innermost value containing it.
+func valuePathAt(decoder *json.Decoder, data []byte, offset int64, path string) (string, bool) {
+	start := skipSpace(data, decoder.InputOffset())
+	token, err := decoder.Token()
+	if err != nil {
+		return "", false
+	}
+	switch token {
+	case json.Delim('{'):
+		for decoder.More() {
+			keyToken, err := decoder.Token()
+			if err != nil {
+				return "", false
+			}
+			keyPath, _ := keyToken.(string)
+			if path != "" {
+				keyPath = path + "." + keyPath
+			}
+			if found, ok := valuePathAt(decoder, data, offset, keyPath); ok {
+				return found, true
+			}
+		}
+		if _, err := decoder.Token(); err != nil { // The closing brace.
+			return "", false
+		}
+	case json.Delim('['):
+		for i := 0; decoder.More(); i++ {
+			if found, ok := valuePathAt(decoder, data, offset, fmt.Sprintf("%s[%d]", path, i)); ok {
+				return found, true
+			}
+		}
+		if _, err := decoder.Token(); err != nil { // The closing bracket.
+			return "", false
+		}
+	}
+	return path, offset >= start && offset < decoder.InputOffset()
+}
+
+// findUnknownFields walks a JSON document alongside the type it is decoded into and returns every
+// object key that matches no field, in document order.
+func findUnknownFields(data []byte, t reflect.Type) ([]unknownField, error) {
+	walker := &fieldWalker{data: data, decoder: json.NewDecoder(bytes.NewReader(data))}
+	if err := walker.walk(t, ""); err != nil {
+		return nil, err
+	}
+	return walker.unknown, nil
+}
+
+// fieldWalker reads the tokens of a JSON document and records keys that match no field.
+type fieldWalker struct {
+	data    []byte
+	decoder *json.Decoder
+	unknown []unknownField
+}
+
+// walk reads one value that decodes into type t, which is nil for values whose keys are not checked.
+func (w *fieldWalker) walk(t reflect.Type, path string) error {
+	for t != nil && t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t != nil && (t.Implements(jsonUnmarshalerType) || reflect.PointerTo(t).Implements(jsonUnmarshalerType)) {
+		t = nil // The type decodes itself, so any keys inside it are its own business.
+	}
+
+	token, err := w.decoder.Token()
+	if err != nil {
+		return err
+	}
+	switch token {
+	case json.Delim('{'):
+		for w.decoder.More() {
+			start := skipSpace(w.data, w.decoder.InputOffset())
+			keyToken, err := w.decoder.Token()
+			if err != nil {
+				return err
+			}
+			key := keyToken.(string)
+			keyPath := key
+			if path != "" {
+				keyPath = path + "." + key
+			}
+
+			var valueType reflect.Type
+			switch {
+			case t == nil:
+			case t.Kind() == reflect.Struct:
+				field, ok := jsonField(t, key)
+				if !ok {
+					w.unknown = append(w.unknown, unknownField{path: keyPath, offset: start})
+				}
+				valueType = field
+			case t.Kind() == reflect.Map:
+				valueType = t.Elem()
+			}
+			if err := w.walk(valueType, keyPath); err != nil {
+				return err
+			}
+		}
+		_, err = w.decoder.Token() // The closing brace.
+		return err
+
+	case json.Delim('['):
+		var elemType reflect.Type
+		if t != nil && (t.Kind() == reflect.Slice || t.Kind() == reflect.Array) {
+			elemType = t.Elem()
+		}
+		for i := 0; w.decoder.More(); i++ {
+			if err := w.walk(elemType, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+		_, err = w.decoder.Token() // The closing bracket.
+		return err
+	}
+	return nil
+}
+
+// jsonField returns the type of the struct field that a JSON object key decodes into. Like
+// encoding/json, it matches keys case-insensitively and looks into embedded structs.
+func jsonField(t reflect.Type, key string) (reflect.Type, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			if embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				if fieldType, ok := jsonField(embedded, key); ok {
+					return fieldType, true
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		if strings.EqualFold(name, key) {
+			return field.Type, true
+		}
+	}
+	return nil, false
+}
+
+// skipSpace returns the offset of the first byte at or after offset that is neither JSON whitespace
+// nor a separator between values.
+func skipSpace(data []byte, offset int64) int64 {
+	for offset < int64(len(data)) {
+		switch data[offset] {
+		case ' ', '\t', '\r', '\n', ',', ':':
+			offset++
+		default:
+			return offset
+		}
+	}
+	return offset
+}
+
+// position converts a byte offset in data to a 1-based line and column.
+func position(data []byte, offset int64) (line, column int) {
+	offset = min(offset, int64(len(data)))
+	before := data[:offset]
+	line = bytes.Count(before, []byte{'\n'}) + 1
+	column = int(offset) - bytes.LastIndexByte(before, '\n')
+	return line, column
+}
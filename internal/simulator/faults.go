@@ -0,0 +1,199 @@
+package simulator
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+)
+
+// FaultType names a kind of failure that can be injected into the readings of a sensor.
+type FaultType string
+
+// Fault types supported by the fault injector.
+const (
+	// FaultStuck makes the sensor report Value, like a sensor stuck at a fixed reading.
+	FaultStuck FaultType = "stuck"
+
+	// FaultFlatline makes the sensor repeat the temperature it had when the fault started.
+	FaultFlatline FaultType = "flatline"
+
+	// FaultSpike makes readings jump up or down, at random, by Value.
+	FaultSpike FaultType = "spike"
+
+	// FaultOffset shifts readings by Value, like a step change in calibration.
+	FaultOffset FaultType = "offset"
+
+	// FaultDrift shifts readings by Value degrees per hour since the fault started, like a gradual
+	// loss of calibration.
+	FaultDrift FaultType = "drift"
+
+	// FaultDropout leaves readings out, like a sensor that stops reporting.
+	FaultDropout FaultType = "dropout"
+
+	// FaultNaN makes readings not a number, written as null in JSON and left out of line protocol.
+	FaultNaN FaultType = "nan"
+
+	// FaultGarbage replaces readings with random values of up to Value in magnitude, 1000 by default.
+	FaultGarbage FaultType = "garbage"
+)
+
+// defaultGarbageMagnitude is the largest magnitude of garbage values when no value is configured.
+const defaultGarbageMagnitude = 1000
+
+// FaultSpec describes a fault injected into the readings of a sensor, either throughout a window of
+// time or by chance.
+//
+// A fault without a probability is active for every reading between Start and End, which default to
+// the start and end of the run. A fault with a probability starts on each reading in that window with
+// that chance, and then lasts for Duration, or for the single reading if Duration is zero. A
+// probability of 0 therefore turns the fault off.
+type FaultSpec struct {
+	Type        FaultType `json:"type"`                  // Kind of fault, e.g. "spike".
+	Probability *float64  `json:"probability,omitempty"` // Chance that the fault starts on a reading, from 0 to 1; nil means always.
+	Duration    Duration  `json:"duration,omitempty"`    // How long a fault started by chance lasts; 0 affects a single reading.
+	Start       string    `json:"start,omitempty"`       // RFC 3339 time from which the fault can occur; empty means from the start.
+	End         string    `json:"end,omitempty"`         // RFC 3339 time until which the fault can occur; empty means until the end.
+	Value       float64   `json:"value,omitempty"`       // Stuck value, spike height, offset, drift per hour or garbage magnitude.
+}
+
+// validate checks the fault and returns its window.
+func (f FaultSpec) validate() (start, end time.Time, err error) {
+	switch f.Type {
+	case FaultStuck, FaultFlatline, FaultSpike, FaultOffset, FaultDrift, FaultDropout, FaultNaN, FaultGarbage:
+	default:
+		return start, end, fmt.Errorf("unknown fault type %q, must be one of stuck, flatline, spike, offset, drift, dropout, nan or garbage", f.Type)
+	}
+	if f.Probability != nil && (*f.Probability < 0 || *f.Probability > 1) {
+		return start, end, fmt.Errorf("probability must be between 0 and 1, got %g", *f.Probability)
+	}
+	if f.Duration < 0 {
+		return start, end, fmt.Errorf("duration must not be negative, got %s", time.Duration(f.Duration))
+	}
+	if f.Start != "" {
+		if start, err = time.Parse(time.RFC3339, f.Start); err != nil {
+			return start, end, fmt.Errorf("start %q is not an RFC 3339 timestamp", f.Start)
+		}
+	}
+	if f.End != "" {
+		if end, err = time.Parse(time.RFC3339, f.End); err != nil {
+			return start, end, fmt.Errorf("end %q is not an RFC 3339 timestamp", f.End)
+		}
+		if !start.IsZero() && !end.After(start) {
+			return start, end, fmt.Errorf("end %s must be after start %s", f.End, f.Start)
+		}
+	}
+	return start, end, nil
+}
+
+// faultInjector applies the faults of a single sensor to its readings, in time order.
+type faultInjector struct {
+	faults []*faultState
+	r      *rand.Rand // Generator of the sensor's faults, separate from the one of the models.
+}
+
+// faultState tracks whether a fault is active and since when.
+type faultState struct {
+	spec       FaultSpec
+	start, end time.Time // Window in which the fault can occur; zero for an open end.
+
+	active bool
+	since  time.Time // Time of the reading on which the fault started.
+	frozen float64   // Temperature when the fault started, repeated by flatline faults.
+}
+
+// newFaultInjector creates an injector for the given faults of the sensor with the given index, drawing
+// its random values from a generator of its own derived from seed. Injecting faults therefore leaves
+// the random values drawn by the models, and so the clean temperatures of a seeded run, unchanged.
+//
+// Returns an error naming the fault if any of them is invalid.
+func newFaultInjector(specs []FaultSpec, seed int64, sensor int) (*faultInjector, error) {
+	injector := &faultInjector{
+		faults: make([]*faultState, len(specs)),
+		r:      rand.New(rand.NewSource(faultSeed(seed, sensor))),
+	}
+	for i, spec := range specs {
+		start, end, err := spec.validate()
+		if err != nil {
+			return nil, fmt.Errorf("faults[%d]: %w", i, err)
+		}
+		injector.faults[i] = &faultState{spec: spec, start: start, end: end}
+	}
+	return injector, nil
+}
+
+// faultSeed derives the seed of the fault generator of a sensor from the seed of the run, spreading
+// the seeds of neighbouring sensors with the 64-bit golden ratio.
+func faultSeed(seed int64, sensor int) int64 {
+	return int64(uint64(seed) ^ uint64(sensor+1)*0x9e3779b97f4a7c15)
+}
+
+// apply injects the faults that are active at time t into a reading of temperature temp. It returns
+// the temperature to report, the types of the injected faults joined by commas, or "" for a clean
+// reading, and whether the reading is dropped.
+func (f *faultInjector) apply(temp float64, t time.Time) (float64, string, bool) {
+	reported := temp
+	var types []string
+	dropped := false
+
+	for _, fault := range f.faults {
+		if !fault.update(temp, t, f.r) {
+			continue
+		}
+		types = append(types, string(fault.spec.Type))
+
+		switch fault.spec.Type {
+		case FaultStuck:
+			reported = fault.spec.Value
+		case FaultFlatline:
+			reported = fault.frozen
+		case FaultSpike:
+			if f.r.Float64() < 0.5 {
+				reported -= fault.spec.Value
+			} else {
+				reported += fault.spec.Value
+			}
+		case FaultOffset:
+			reported += fault.spec.Value
+		case FaultDrift:
+			reported += fault.spec.Value * t.Sub(fault.since).Hours()
+		case FaultDropout:
+			dropped = true
+		case FaultNaN:
+			reported = math.NaN()
+		case FaultGarbage:
+			magnitude := fault.spec.Value
+			if magnitude == 0 {
+				magnitude = defaultGarbageMagnitude
+			}
+			reported = (f.r.Float64()*2 - 1) * magnitude
+		}
+	}
+	return reported, strings.Join(types, ","), dropped
+}
+
+// update reports whether the fault is active for the reading of temperature temp at time t, ending
+// it when its duration has passed and starting it by chance.
+func (s *faultState) update(temp float64, t time.Time, r *rand.Rand) bool {
+	if (!s.start.IsZero() && t.Before(s.start)) || (!s.end.IsZero() && !t.Before(s.end)) {
+		s.active = false
+		return false
+	}
+
+	switch {
+	case s.spec.Probability == nil:
+		if !s.active {
+			s.active, s.since, s.frozen = true, t, temp
+		}
+	case *s.spec.Probability == 0:
+		s.active = false
+	case s.active && t.Before(s.since.Add(time.Duration(s.spec.Duration))):
+		// The fault started by chance and lasts a while longer.
+	case r.Float64() < *s.spec.Probability:
+		s.active, s.since, s.frozen = true, t, temp
+	default:
+		s.active = false
+	}
+	return s.active
+}
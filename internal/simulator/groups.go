@@ -0,0 +1,109 @@
+package simulator
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+)
+
+// SensorGroup describes a number of similar sensors, such as the racks of a data center, which are
+// expanded into individual sensors when the configuration is loaded.
+//
+// The name, ID, version and location of the template are patterns in which "{n}" is replaced by the
+// number of each sensor, counting from Start. A width pads the number with spaces and a width with a
+// leading zero pads it with zeros, so "rack-{n:03}" yields "rack-001", "rack-002" and so on. Every
+// other field of the template, such as the interval and temperature overrides, is copied as is.
+type SensorGroup struct {
+	Count    int    `json:"count"`           // Number of sensors in the group.
+	Start    *int   `json:"start,omitempty"` // Number of the first sensor; defaults to 1.
+	Template Sensor `json:"template"`        // Sensor whose text fields are patterns, e.g. "rack-{n:03}".
+}
+
+// maxSensorGroupCount is the largest number of sensors in a group, which keeps a mistyped count from
+// exhausting memory before anything else is checked.
+const maxSensorGroupCount = 100000
+
+// sensorNumber matches the placeholders of sensor group patterns: "{n}", "{n:3}" or "{n:03}".
+var sensorNumber = regexp.MustCompile(`\{n(?::(0?)([1-9][0-9]*))?\}`)
+
+// ExpandSensorGroups appends the sensors of every sensor group to Sensors, in order, and clears
+// SensorGroups, so that the configuration lists every sensor individually. Each expanded sensor
+// remembers its group and number, so that validation reports problems where they were configured.
+//
+// Returns a FieldError if a group has a count that is not positive or above 100000, or if it yields
+// an ID that is already used by another sensor.
+func (sc *SensorConfig) ExpandSensorGroups() error {
+	for i, group := range sc.SensorGroups {
+		if group.Count <= 0 || group.Count > maxSensorGroupCount {
+			return FieldError{
+				Path:    fmt.Sprintf("sensorGroups[%d].count", i),
+				Message: fmt.Sprintf("must be between 1 and %d, got %d", maxSensorGroupCount, group.Count),
+			}
+		}
+	}
+	if len(sc.SensorGroups) > 0 && len(sc.origins) < len(sc.Sensors) {
+		sc.origins = append(sc.origins, make([]string, len(sc.Sensors)-len(sc.origins))...)
+	}
+
+	// Remember the sensor first using each ID, so that a group yielding the same ID again is reported
+	// against the group rather than against an index of the expanded sensors.
+	seen := make(map[string]int, len(sc.Sensors))
+	for i, sensor := range sc.Sensors {
+		if _, ok := seen[sensor.ID]; !ok && sensor.ID != "" {
+			seen[sensor.ID] = i
+		}
+	}
+
+	for i, group := range sc.SensorGroups {
+		start := 1
+		if group.Start != nil {
+			start = *group.Start
+		}
+
+		for n := start; n < start+group.Count; n++ {
+			sensor := group.Template
+			sensor.Name = expandPattern(sensor.Name, n)
+			sensor.ID = expandPattern(sensor.ID, n)
+			sensor.Version = expandPattern(sensor.Version, n)
+			sensor.Location = expandPattern(sensor.Location, n)
+			origin := fmt.Sprintf("sensorGroups[%d] (n=%d)", i, n)
+			if first, ok := seen[sensor.ID]; ok {
+				return FieldError{
+					Path:    origin + ".id",
+					Message: fmt.Sprintf("duplicate %q, also used by %s", sensor.ID, sc.sensorPath(first)),
+				}
+			}
+			if sensor.ID != "" {
+				seen[sensor.ID] = len(sc.Sensors)
+			}
+			sc.Sensors = append(sc.Sensors, sensor)
+			sc.origins = append(sc.origins, origin)
+		}
+	}
+	sc.SensorGroups = nil
+	return nil
+}
+
+// sensorPath returns the path at which the sensor with index i was configured: "sensors[i]" for a
+// sensor listed in the sensors array, or its group and number for a sensor expanded from a group.
+func (sc *SensorConfig) sensorPath(i int) string {
+	if i < len(sc.origins) && sc.origins[i] != "" {
+		return sc.origins[i]
+	}
+	return fmt.Sprintf("sensors[%d]", i)
+}
+
+// expandPattern replaces the placeholders of a sensor group pattern with the sensor number n.
+func expandPattern(pattern string, n int) string {
+	return sensorNumber.ReplaceAllStringFunc(pattern, func(placeholder string) string {
+		match := sensorNumber.FindStringSubmatch(placeholder)
+		if match[2] == "" {
+			return strconv.Itoa(n)
+		}
+		width, _ := strconv.Atoi(match[2])
+		if match[1] == "0" {
+			return fmt.Sprintf("%0*d", width, n)
+		}
+		return fmt.Sprintf("%*d", width, n)
+	})
+}
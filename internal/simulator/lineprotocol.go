@@ -0,0 +1,307 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// defaultMeasurement is the line protocol measurement name used when none is configured.
+	defaultMeasurement = "temperature"
+
+	// defaultInfluxRetries is the number of times a failed write is retried when not configured.
+	defaultInfluxRetries = 3
+
+	// defaultInfluxRetryBackoff is the delay before the first retry; it doubles with every attempt.
+	defaultInfluxRetryBackoff = time.Second
+
+	// influxWritePath is the path of the InfluxDB v2 write endpoint.
+	influxWritePath = "/api/v2/write"
+)
+
+var (
+	// measurementEscaper escapes the special characters of line protocol measurement names.
+	measurementEscaper = strings.NewReplacer(`,`, `\,`, ` `, `\ `)
+
+	// tagEscaper escapes the special characters of line protocol tag keys and values.
+	tagEscaper = strings.NewReplacer(`,`, `\,`, `=`, `\=`, ` `, `\ `)
+)
+
+// AppendLineProtocol appends a reading to dst as a single line of InfluxDB line protocol.
+// The sensor metadata and the types of injected faults are written as tags, the temperature and seed
+// as fields, and the time of the reading as a timestamp in nanoseconds. Empty tags are left out, as
+// InfluxDB rejects empty tag values, and so is a temperature that is not a number.
+//
+// Returns the extended buffer, or an error if the time of the reading cannot be parsed.
+func AppendLineProtocol(dst []byte, measurement string, reading TemperatureReading) ([]byte, error) {
+	timestamp, err := reading.Timestamp()
+	if err != nil {
+		return dst, fmt.Errorf("invalid reading time %q: %w", reading.Time, err)
+	}
+	if measurement == "" {
+		measurement = defaultMeasurement
+	}
+
+	dst = append(dst, measurementEscaper.Replace(measurement)...)
+
+	// Tags must be sorted by key for the best write performance.
+	tags := [...]struct{ key, value string }{
+		{"fault", reading.Fault},
+		{"id", reading.Sensor.ID},
+		{"location", reading.Sensor.Location},
+		{"name", reading.Sensor.Name},
+		{"version", reading.Sensor.Version},
+	}
+	for _, tag := range tags {
+		if tag.value == "" {
+			continue
+		}
+		dst = append(dst, ',')
+		dst = append(dst, tag.key...)
+		dst = append(dst, '=')
+		dst = append(dst, tagEscaper.Replace(tag.value)...)
+	}
+
+	dst = append(dst, ' ')
+	if temp := float64(reading.Temperature); !math.IsNaN(temp) && !math.IsInf(temp, 0) {
+		dst = append(dst, "temperature="...)
+		dst = strconv.AppendFloat(dst, temp, 'f', 2, 64)
+		dst = append(dst, ',')
+	}
+	dst = append(dst, "seed="...)
+	dst = strconv.AppendInt(dst, reading.Seed, 10)
+	dst = append(dst, 'i', ' ')
+	dst = strconv.AppendInt(dst, timestamp.UnixNano(), 10)
+	dst = append(dst, '\n')
+	return dst, nil
+}
+
+// LineProtocolSink writes readings in InfluxDB line protocol to a file, or to standard output
+// when the path is "stdout".
+type LineProtocolSink struct {
+	Path        string // Path of the output file, or "stdout".
+	Measurement string // Measurement name; defaults to "temperature".
+
+	file   *os.File
+	writer *bufio.Writer
+	line   []byte
+}
+
+// Open creates the output file, truncating it if it already exists.
+func (s *LineProtocolSink) Open() error {
+	if s.Path == "stdout" {
+		s.writer = bufio.NewWriterSize(os.Stdout, 4096)
+		return nil
+	}
+
+	file, err := os.Create(s.Path)
+	if err != nil {
+		return fmt.Errorf("error creating line protocol file: %w", err)
+	}
+	s.file = file
+	s.writer = bufio.NewWriterSize(file, 4096)
+	return nil
+}
+
+// Write appends the reading to the output as a line of line protocol.
+func (s *LineProtocolSink) Write(reading TemperatureReading) error {
+	line, err := AppendLineProtocol(s.line[:0], s.Measurement, reading)
+	if err != nil {
+		return err
+	}
+	s.line = line
+	if _, err := s.writer.Write(line); err != nil {
+		return fmt.Errorf("error writing line protocol data: %w", err)
+	}
+	return nil
+}
+
+// Flush writes any buffered readings to the output.
+func (s *LineProtocolSink) Flush() error {
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("error flushing line protocol data: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the buffered readings and closes the output file.
+func (s *LineProtocolSink) Close() error {
+	err := s.Flush()
+	if s.file != nil {
+		if cerr := s.file.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing line protocol file: %w", cerr))
+		}
+	}
+	return err
+}
+
+// InfluxSink writes readings to an InfluxDB-compatible /api/v2/write endpoint in batches of line
+// protocol. A batch is sent when it reaches the batch size and whenever the sink is flushed.
+// Requests that fail with a network error, 429 or a 5xx status are retried with exponential backoff,
+// until the sink is stopped.
+type InfluxSink struct {
+	URL          string        // Base URL of the server, e.g. "http://localhost:8086", or the full write endpoint.
+	Org          string        // Organization that owns the bucket.
+	Bucket       string        // Bucket receiving the readings.
+	Token        string        // API token sent in the Authorization header, if set.
+	Measurement  string        // Measurement name; defaults to "temperature".
+	BatchSize    int           // Number of readings per request; defaults to 500.
+	MaxRetries   *int          // Retries of a failed request; 0 disables retries, nil defaults to 3.
+	RetryBackoff time.Duration // Delay before the first retry, doubled for each further retry; defaults to 1s.
+	Gzip         bool          // Compress request bodies with gzip.
+	Client       *http.Client  // HTTP client used for requests; defaults to a client with a 30 second timeout.
+	Logger       *slog.Logger  // Logger for retries and failures; defaults to the default logger.
+
+	writeURL string
+	batch    []byte
+	pending  int
+	retries  retryWait
+}
+
+// Open builds the write URL; no connection is made until the first batch is sent.
+func (s *InfluxSink) Open() error {
+	if s.BatchSize <= 0 {
+		s.BatchSize = defaultHTTPBatchSize
+	}
+	if s.MaxRetries == nil {
+		maxRetries := defaultInfluxRetries
+		s.MaxRetries = &maxRetries
+	} else if *s.MaxRetries < 0 {
+		return fmt.Errorf("influx max retries must not be negative, got %d", *s.MaxRetries)
+	}
+	if s.RetryBackoff <= 0 {
+		s.RetryBackoff = defaultInfluxRetryBackoff
+	}
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: httpTimeout}
+	}
+	s.Logger = loggerOrDefault(s.Logger)
+
+	endpoint, err := url.Parse(s.URL)
+	if err != nil {
+		return fmt.Errorf("invalid influx url %q: %w", s.URL, err)
+	}
+	if !strings.HasSuffix(endpoint.Path, influxWritePath) {
+		endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + influxWritePath
+	}
+	query := endpoint.Query()
+	if s.Org != "" {
+		query.Set("org", s.Org)
+	}
+	query.Set("bucket", s.Bucket)
+	query.Set("precision", "ns")
+	endpoint.RawQuery = query.Encode()
+	s.writeURL = endpoint.String()
+	return nil
+}
+
+// Write adds the reading to the current batch and sends the batch once it is full.
+func (s *InfluxSink) Write(reading TemperatureReading) error {
+	batch, err := AppendLineProtocol(s.batch, s.Measurement, reading)
+	if err != nil {
+		return err
+	}
+	s.batch = batch
+	s.pending++
+	if s.pending >= s.BatchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the current batch, if any, retrying transient failures.
+func (s *InfluxSink) Flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+
+	body := s.batch
+	if s.Gzip {
+		var compressed bytes.Buffer
+		gz := gzip.NewWriter(&compressed)
+		if _, err := gz.Write(s.batch); err != nil {
+			return fmt.Errorf("error compressing line protocol data: %w", err)
+		}
+		if err := gz.Close(); err != nil {
+			return fmt.Errorf("error compressing line protocol data: %w", err)
+		}
+		body = compressed.Bytes()
+	}
+
+	backoff := s.RetryBackoff
+	for attempt := 0; ; attempt++ {
+		retry, err := s.post(body)
+		if err == nil {
+			break
+		}
+		if !retry || attempt >= *s.MaxRetries {
+			s.Logger.Error("Error writing readings", "url", s.URL, "readings", s.pending, "attempts", attempt+1, "error", err)
+			return err
+		}
+		s.Logger.Warn("Retrying write after error", "url", s.URL, "backoff", backoff, "error", err)
+		if !s.retries.sleep(backoff) {
+			s.Logger.Error("Stopped retrying write", "url", s.URL, "readings", s.pending, "attempts", attempt+1, "error", err)
+			return err
+		}
+		backoff *= 2
+	}
+
+	s.batch = s.batch[:0]
+	s.pending = 0
+	return nil
+}
+
+// post sends one request with the given body. It reports whether a failed request may be retried.
+func (s *InfluxSink) post(body []byte) (bool, error) {
+	req, err := http.NewRequest(http.MethodPost, s.writeURL, bytes.NewReader(body))
+	if err != nil {
+		return false, fmt.Errorf("error creating influx request: %w", err)
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Token "+s.Token)
+	}
+	if s.Gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return true, fmt.Errorf("error sending line protocol data: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			s.Logger.Warn("Error closing HTTP response body", "url", s.URL, "error", err)
+		}
+	}()
+
+	if resp.StatusCode >= 200 && resp.StatusCode <= 299 {
+		return false, nil
+	}
+	message, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("unexpected status %s: %s", resp.Status, strings.TrimSpace(string(message)))
+	return resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500, err
+}
+
+// Stop ends a wait between retries, failing the write being retried, and disables further retries.
+// It may be called from any goroutine, e.g. on shutdown, while a write is in progress.
+func (s *InfluxSink) Stop() {
+	s.retries.interrupt()
+}
+
+// Close sends any readings that are still buffered.
+func (s *InfluxSink) Close() error {
+	return s.Flush()
+}
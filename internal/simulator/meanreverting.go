@@ -0,0 +1,53 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// meanRevertingParams holds the parameters of the mean-reverting model.
+type meanRevertingParams struct {
+	Setpoint      *float64 `json:"setpoint,omitempty"` // Operating point the temperature reverts to; defaults to the starting temperature.
+	ReversionRate float64  `json:"reversionRate"`      // Speed of reversion per hour; defaults to 1.
+	Volatility    float64  `json:"volatility"`         // Strength of the noise in degrees per square root of an hour; defaults to 1.
+}
+
+// meanRevertingModel is an Ornstein-Uhlenbeck process: the temperature is pulled towards the setpoint
+// at the reversion rate while being pushed around by normally distributed noise. Unlike the random
+// walk of the sawtooth model it stays near the setpoint on long runs, with a long-run mean of the
+// setpoint and a long-run variance of volatility² / (2 × reversionRate).
+//
+// Each step uses the exact transition of the process over the reading's interval, so the statistics
+// do not depend on how often the sensor reads.
+type meanRevertingModel struct {
+	params meanRevertingParams
+}
+
+// newMeanRevertingModel creates a mean-reverting model from its parameters.
+func newMeanRevertingModel(params json.RawMessage) (Model, error) {
+	p := meanRevertingParams{ReversionRate: 1, Volatility: 1}
+	if err := decodeModelParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.ReversionRate <= 0:
+		return nil, fmt.Errorf("reversionRate must be positive, got %g", p.ReversionRate)
+	case p.Volatility < 0:
+		return nil, fmt.Errorf("volatility must not be negative, got %g", p.Volatility)
+	}
+	return &meanRevertingModel{params: p}, nil
+}
+
+// Next moves the temperature over the reading's interval.
+func (m *meanRevertingModel) Next(state ModelState, r *rand.Rand) float64 {
+	setpoint := state.Params.StartingTemp
+	if m.params.Setpoint != nil {
+		setpoint = *m.params.Setpoint
+	}
+
+	decay := math.Exp(-m.params.ReversionRate * state.Interval.Hours())
+	stddev := m.params.Volatility * math.Sqrt((1-decay*decay)/(2*m.params.ReversionRate))
+	return setpoint + (state.Temperature-setpoint)*decay + stddev*r.NormFloat64()
+}
@@ -0,0 +1,119 @@
+package simulator
+
+import (
+	"bytes"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// labelEscaper escapes label values in the Prometheus text exposition format.
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sensorMetrics holds the latest state exported for a single sensor.
+type sensorMetrics struct {
+	labels      string  // Rendered label set, e.g. `{name="SensorA",id="001",...}`.
+	temperature float64 // Most recent temperature reading.
+	readings    uint64  // Number of readings produced.
+	clamped     uint64  // Number of readings clamped to the min/max range.
+	faulty      uint64  // Number of readings with injected faults.
+}
+
+// Metrics exposes the latest simulated temperatures in the Prometheus text exposition format.
+// It implements Sink, so it can be fed by the generator alongside other outputs, and http.Handler,
+// so it can be served on a /metrics endpoint. It is safe for concurrent use.
+type Metrics struct {
+	logger  *slog.Logger
+	mu      sync.Mutex
+	sensors map[sensorMetadata]*sensorMetrics
+	order   []*sensorMetrics
+}
+
+// NewMetrics returns an empty Metrics collector that reports errors serving scrapes to the logger;
+// nil uses the default logger.
+func NewMetrics(logger *slog.Logger) *Metrics {
+	return &Metrics{logger: loggerOrDefault(logger), sensors: make(map[sensorMetadata]*sensorMetrics)}
+}
+
+// Open does nothing; Metrics has no underlying resources.
+func (m *Metrics) Open() error {
+	return nil
+}
+
+// Write records the reading as the current temperature of its sensor and updates the counters.
+func (m *Metrics) Write(reading TemperatureReading) error {
+	key := sensorMetadata{
+		Name:     reading.Sensor.Name,
+		ID:       reading.Sensor.ID,
+		Version:  reading.Sensor.Version,
+		Location: reading.Sensor.Location,
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	sensor, ok := m.sensors[key]
+	if !ok {
+		sensor = &sensorMetrics{labels: fmt.Sprintf(`{name="%s",id="%s",version="%s",location="%s"}`,
+			labelEscaper.Replace(key.Name), labelEscaper.Replace(key.ID),
+			labelEscaper.Replace(key.Version), labelEscaper.Replace(key.Location))}
+		m.sensors[key] = sensor
+		m.order = append(m.order, sensor)
+	}
+	sensor.temperature = float64(reading.Temperature)
+	sensor.readings++
+	if reading.Clamped {
+		sensor.clamped++
+	}
+	if reading.Fault != "" {
+		sensor.faulty++
+	}
+	return nil
+}
+
+// Flush does nothing; metrics are updated as soon as a reading is written.
+func (m *Metrics) Flush() error {
+	return nil
+}
+
+// Close does nothing; the last values remain available to scrapes.
+func (m *Metrics) Close() error {
+	return nil
+}
+
+// ServeHTTP writes the current metrics in the Prometheus text exposition format.
+// The metrics are rendered before the response is written, so that a slow scraper does not hold up
+// the readings written in the meantime.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var buf bytes.Buffer
+
+	m.mu.Lock()
+	m.writeMetric(&buf, "temperature_simulator_sensor_temperature", "gauge",
+		"Most recent simulated temperature of the sensor.",
+		func(s *sensorMetrics) string { return strconv.FormatFloat(s.temperature, 'f', -1, 64) })
+	m.writeMetric(&buf, "temperature_simulator_readings_total", "counter",
+		"Number of temperature readings produced for the sensor.",
+		func(s *sensorMetrics) string { return strconv.FormatUint(s.readings, 10) })
+	m.writeMetric(&buf, "temperature_simulator_clamped_readings_total", "counter",
+		"Number of temperature readings clamped to the configured min/max range.",
+		func(s *sensorMetrics) string { return strconv.FormatUint(s.clamped, 10) })
+	m.writeMetric(&buf, "temperature_simulator_faulty_readings_total", "counter",
+		"Number of temperature readings with injected faults.",
+		func(s *sensorMetrics) string { return strconv.FormatUint(s.faulty, 10) })
+	m.mu.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := buf.WriteTo(w); err != nil {
+		m.logger.Warn("Error writing metrics response", "error", err)
+	}
+}
+
+// writeMetric writes one metric family with a sample per sensor. The caller must hold the lock.
+func (m *Metrics) writeMetric(w *bytes.Buffer, name, metricType, help string, value func(*sensorMetrics) string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, metricType)
+	for _, sensor := range m.order {
+		fmt.Fprintf(w, "%s%s %s\n", name, sensor.labels, value(sensor))
+	}
+}
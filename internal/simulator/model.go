@@ -0,0 +1,123 @@
+package simulator
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Model produces the temperatures of a single sensor. The generator creates one model per sensor,
+// so a model may keep state between readings, and calls Next once for every reading in time order.
+//
+// Models return the temperature before it is clamped: the generator clamps every temperature to the
+// sensor's MinTemp and MaxTemp, and passes the clamped value back as the previous temperature.
+type Model interface {
+	// Next returns the temperature of the reading described by state. Random numbers must be drawn
+	// from r, so that seeded runs are reproducible.
+	Next(state ModelState, r *rand.Rand) float64
+}
+
+// modelSeed derives the seed of the model generator of a sensor from the seed of the run. Like
+// faultSeed it spreads the seeds of neighbouring sensors, with a different odd constant so that the
+// models and faults of a sensor draw different values.
+func modelSeed(seed int64, sensor int) int64 {
+	return int64(uint64(seed) ^ uint64(sensor+1)*0xbf58476d1ce4e5b9)
+}
+
+// ModelState describes a reading that a model is asked to produce.
+type ModelState struct {
+	Temperature float64       // Temperature of the sensor's previous reading, or its starting temperature.
+	Time        time.Time     // Time of the reading.
+	Elapsed     time.Duration // Simulated time from the start of the run to the reading.
+	Interval    time.Duration // Simulated time since the sensor's previous reading, or since the start.
+	Params      SensorParams  // Temperature parameters of the sensor.
+}
+
+// ModelSpec selects the model of a sensor by name, with its model-specific parameters.
+type ModelSpec struct {
+	Name   string          `json:"name"`             // Name of a registered model, e.g. "sawtooth".
+	Params json.RawMessage `json:"params,omitempty"` // Parameters of the model as a JSON object.
+}
+
+// ModelFactory creates a model from its parameters, which are empty when none are configured.
+type ModelFactory func(params json.RawMessage) (Model, error)
+
+// defaultModel is the model of sensors that do not select one.
+const defaultModel = "sawtooth"
+
+var (
+	modelsMu sync.RWMutex
+
+	// modelFactories holds the registered models by name, starting with the built-in ones.
+	modelFactories = map[string]ModelFactory{
+		"cyclic":        newCyclicModel,
+		"meanReverting": newMeanRevertingModel,
+		"sawtooth":      newSawtoothModel,
+		"thermal":       newThermalModel,
+	}
+)
+
+// RegisterModel makes a model available to sensors under the given name. It is intended to be called
+// from init functions, and panics if the name is empty or already registered.
+func RegisterModel(name string, factory ModelFactory) {
+	modelsMu.Lock()
+	defer modelsMu.Unlock()
+	if name == "" || factory == nil {
+		panic("simulator: RegisterModel requires a name and a factory")
+	}
+	if _, ok := modelFactories[name]; ok {
+		panic("simulator: RegisterModel called twice for model " + name)
+	}
+	modelFactories[name] = factory
+}
+
+// ModelNames returns the names of all registered models, sorted.
+func ModelNames() []string {
+	modelsMu.RLock()
+	defer modelsMu.RUnlock()
+	names := make([]string, 0, len(modelFactories))
+	for name := range modelFactories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// NewModel creates the model selected by spec, or the sawtooth model if spec is nil.
+//
+// Returns an error if no model of that name is registered or its parameters are invalid.
+func NewModel(spec *ModelSpec) (Model, error) {
+	name, params := defaultModel, json.RawMessage(nil)
+	if spec != nil {
+		name, params = spec.Name, spec.Params
+	}
+
+	modelsMu.RLock()
+	factory, ok := modelFactories[name]
+	modelsMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown model %q, must be one of %s", name, strings.Join(ModelNames(), ", "))
+	}
+
+	model, err := factory(params)
+	if err != nil {
+		return nil, fmt.Errorf("invalid parameters for model %s: %w", name, err)
+	}
+	return model, nil
+}
+
+// decodeModelParams decodes the parameters of a model into v, rejecting keys that match no field of
+// v. Empty parameters leave v unchanged.
+func decodeModelParams(params json.RawMessage, v any) error {
+	if len(params) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(params))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
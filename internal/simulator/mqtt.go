@@ -0,0 +1,596 @@
+package simulator
+
+import (
+	"bufio"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// MQTT protocol levels sent in the CONNECT packet.
+const (
+	MQTTv311 = 4 // MQTT 3.1.1.
+	MQTTv5   = 5 // MQTT 5.0.
+)
+
+// MQTT control packet types, in the high nibble of the fixed header.
+const (
+	mqttConnect    = 0x10
+	mqttConnack    = 0x20
+	mqttPublish    = 0x30
+	mqttPuback     = 0x40
+	mqttPubrec     = 0x50
+	mqttPubrel     = 0x62 // PUBREL requires the reserved flags 0010.
+	mqttPubcomp    = 0x70
+	mqttPingreq    = 0xC0
+	mqttPingresp   = 0xD0
+	mqttDisconnect = 0xE0
+)
+
+const (
+	// defaultMQTTTopic is the topic template used when none is configured.
+	defaultMQTTTopic = "sensors/{id}/temperature"
+
+	// defaultMQTTKeepAlive is the keep-alive interval announced to the broker.
+	defaultMQTTKeepAlive = 30 * time.Second
+
+	// defaultMQTTReconnects is the number of reconnection attempts before a publish fails.
+	defaultMQTTReconnects = 5
+
+	// defaultMQTTReconnectBackoff is the delay before the first reconnection attempt.
+	defaultMQTTReconnectBackoff = time.Second
+
+	// maxMQTTReconnectBackoff caps the exponentially growing delay between reconnection attempts.
+	maxMQTTReconnectBackoff = 30 * time.Second
+
+	// mqttTimeout bounds connecting to the broker and waiting for an acknowledgement.
+	mqttTimeout = 10 * time.Second
+)
+
+// MQTTSink publishes every reading as a JSON message to an MQTT broker, using MQTT 3.1.1 or 5.
+// The topic is built from a template in which {name}, {id}, {version} and {location} are replaced
+// by the fields of the reading's sensor. Lost connections are re-established with exponential backoff,
+// until the sink is stopped or closed, and the interrupted message is published again.
+type MQTTSink struct {
+	Broker           string        // Broker URL: tcp://host:1883, or ssl://, tls:// or mqtts:// for TLS.
+	Topic            string        // Topic template, e.g. "plant/{location}/{id}/temperature".
+	ClientID         string        // Client identifier; defaults to a generated one.
+	QoS              byte          // Quality of service: 0, 1 or 2.
+	Retain           bool          // Ask the broker to retain the last message of each topic.
+	ProtocolVersion  byte          // MQTTv311 or MQTTv5; defaults to MQTTv311.
+	Username         string        // Username for authentication, if set.
+	Password         string        // Password for authentication, if set.
+	TLSConfig        *tls.Config   // TLS settings for TLS brokers; defaults to verifying the broker host name.
+	KeepAlive        time.Duration // Keep-alive interval; defaults to 30 seconds.
+	MaxReconnects    *int          // Reconnection attempts before a publish fails; 0 disables reconnects, nil defaults to 5.
+	ReconnectBackoff time.Duration // Delay before the first reconnection attempt; defaults to 1s.
+	Logger           *slog.Logger  // Logger for connections and reconnects; defaults to the default logger.
+
+	mu       sync.Mutex
+	conn     net.Conn
+	reader   *bufio.Reader
+	packetID uint16
+	lastRead time.Time
+	stop     chan struct{}
+	retries  retryWait
+}
+
+// Open validates the settings, connects to the broker and starts sending keep-alive pings.
+func (s *MQTTSink) Open() error {
+	if s.Topic == "" {
+		s.Topic = defaultMQTTTopic
+	}
+	if strings.ContainsAny(s.Topic, "+#") {
+		return fmt.Errorf("mqtt topic must not contain wildcards: %s", s.Topic)
+	}
+	if s.QoS > 2 {
+		return fmt.Errorf("invalid mqtt qos %d: must be 0, 1 or 2", s.QoS)
+	}
+	switch s.ProtocolVersion {
+	case 0:
+		s.ProtocolVersion = MQTTv311
+	case MQTTv311, MQTTv5:
+	default:
+		return fmt.Errorf("unsupported mqtt protocol version %d", s.ProtocolVersion)
+	}
+	if s.ClientID == "" {
+		s.ClientID = fmt.Sprintf("temperature-simulator-%d-%d", os.Getpid(), time.Now().UnixNano()%1e6)
+	}
+	if s.KeepAlive <= 0 {
+		s.KeepAlive = defaultMQTTKeepAlive
+	}
+	if s.MaxReconnects == nil {
+		maxReconnects := defaultMQTTReconnects
+		s.MaxReconnects = &maxReconnects
+	} else if *s.MaxReconnects < 0 {
+		return fmt.Errorf("mqtt max reconnects must not be negative, got %d", *s.MaxReconnects)
+	}
+	if s.ReconnectBackoff <= 0 {
+		s.ReconnectBackoff = defaultMQTTReconnectBackoff
+	}
+	s.Logger = loggerOrDefault(s.Logger)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if err := s.connect(); err != nil {
+		return err
+	}
+	s.stop = make(chan struct{})
+	go s.keepAlive(s.stop)
+	return nil
+}
+
+// Write publishes the reading, reconnecting to the broker if the connection has been lost.
+func (s *MQTTSink) Write(reading TemperatureReading) error {
+	payload, err := json.Marshal(reading)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON data: %w", err)
+	}
+	topic, err := mqttTopic(s.Topic, reading.Sensor)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	backoff := s.ReconnectBackoff
+	for attempt := 0; ; attempt++ {
+		err := s.ensureConnected()
+		if err == nil {
+			// A message that may have reached the broker before the failure is marked as a duplicate.
+			if err = s.publish(topic, payload, attempt > 0); err == nil {
+				return nil
+			}
+			s.closeConn()
+		}
+
+		if attempt >= *s.MaxReconnects {
+			s.Logger.Error("Error publishing to MQTT broker", "broker", s.Broker, "attempts", attempt+1, "error", err)
+			return fmt.Errorf("error publishing to mqtt broker: %w", err)
+		}
+		s.Logger.Warn("Reconnecting to MQTT broker after error", "broker", s.Broker, "backoff", backoff, "error", err)
+		if !s.retries.sleep(backoff) {
+			s.Logger.Error("Stopped reconnecting to MQTT broker", "broker", s.Broker, "attempts", attempt+1, "error", err)
+			return fmt.Errorf("error publishing to mqtt broker: %w", err)
+		}
+		backoff = min(backoff*2, maxMQTTReconnectBackoff)
+	}
+}
+
+// Flush does nothing; every message is published as soon as it is written.
+func (s *MQTTSink) Flush() error {
+	return nil
+}
+
+// Stop ends a wait before reconnecting, failing the publish in progress, and disables further
+// reconnects. It may be called from any goroutine, e.g. on shutdown, while a write is in progress.
+func (s *MQTTSink) Stop() {
+	s.retries.interrupt()
+}
+
+// Close stops the keep-alive pings and disconnects from the broker. A publish waiting to reconnect
+// gives up first, so that closing is not held up by the reconnect backoff.
+func (s *MQTTSink) Close() error {
+	s.Stop()
+	if s.stop != nil {
+		close(s.stop)
+		s.stop = nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.send(mqttPacket(mqttDisconnect, nil))
+	if cerr := s.conn.Close(); cerr != nil {
+		err = errors.Join(err, cerr)
+	}
+	s.conn = nil
+	if err != nil {
+		return fmt.Errorf("error disconnecting from mqtt broker: %w", err)
+	}
+	return nil
+}
+
+// ensureConnected connects to the broker unless a connection is already established.
+// The caller must hold the lock.
+func (s *MQTTSink) ensureConnected() error {
+	if s.conn != nil {
+		return nil
+	}
+	return s.connect()
+}
+
+// connect dials the broker and performs the CONNECT/CONNACK handshake. The caller must hold the lock.
+func (s *MQTTSink) connect() error {
+	broker, err := url.Parse(s.Broker)
+	if err != nil {
+		return fmt.Errorf("invalid mqtt broker url %q: %w", s.Broker, err)
+	}
+
+	dialer := &net.Dialer{Timeout: mqttTimeout}
+	var conn net.Conn
+	switch broker.Scheme {
+	case "tcp", "mqtt":
+		conn, err = dialer.Dial("tcp", hostWithPort(broker, "1883"))
+	case "ssl", "tls", "mqtts":
+		tlsConfig := s.TLSConfig
+		if tlsConfig == nil {
+			tlsConfig = &tls.Config{ServerName: broker.Hostname()}
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", hostWithPort(broker, "8883"), tlsConfig)
+	default:
+		return fmt.Errorf("unsupported mqtt broker scheme: %s", broker.Scheme)
+	}
+	if err != nil {
+		return fmt.Errorf("error connecting to mqtt broker: %w", err)
+	}
+	s.conn = conn
+	s.reader = bufio.NewReader(conn)
+
+	// Build the CONNECT packet: protocol name and level, flags, keep-alive, then the payload.
+	flags := byte(0x02) // Clean session (3.1.1) or clean start (5).
+	if s.Username != "" {
+		flags |= 0x80
+	}
+	if s.Password != "" {
+		flags |= 0x40
+	}
+	keepAlive := uint16(s.KeepAlive / time.Second)
+	body := appendMQTTString(nil, "MQTT")
+	body = append(body, s.ProtocolVersion, flags, byte(keepAlive>>8), byte(keepAlive))
+	if s.ProtocolVersion == MQTTv5 {
+		body = append(body, 0) // No properties.
+	}
+	body = appendMQTTString(body, s.ClientID)
+	if s.Username != "" {
+		body = appendMQTTString(body, s.Username)
+	}
+	if s.Password != "" {
+		body = appendMQTTString(body, s.Password)
+	}
+	if err := s.send(mqttPacket(mqttConnect, body)); err != nil {
+		s.closeConn()
+		return err
+	}
+
+	// The CONNACK carries the acknowledge flags and a return code (3.1.1) or reason code (5).
+	header, ack, err := s.readPacket()
+	if err != nil {
+		s.closeConn()
+		return fmt.Errorf("error reading mqtt connack: %w", err)
+	}
+	if header&0xF0 != mqttConnack || len(ack) < 2 {
+		s.closeConn()
+		return fmt.Errorf("unexpected mqtt packet 0x%02x instead of connack", header)
+	}
+	if ack[1] != 0 {
+		s.closeConn()
+		return fmt.Errorf("mqtt broker refused connection with code 0x%02x", ack[1])
+	}
+
+	s.Logger.Info("Connected to MQTT broker", "broker", s.Broker, "clientId", s.ClientID)
+	return nil
+}
+
+// publish sends a PUBLISH packet and completes the acknowledgement flow of its QoS level.
+// The caller must hold the lock.
+func (s *MQTTSink) publish(topic string, payload []byte, dup bool) error {
+	header := byte(mqttPublish) | s.QoS<<1
+	if s.Retain {
+		header |= 0x01
+	}
+	if dup && s.QoS > 0 {
+		header |= 0x08
+	}
+
+	body := appendMQTTString(nil, topic)
+	var id uint16
+	if s.QoS > 0 {
+		id = s.nextPacketID()
+		body = append(body, byte(id>>8), byte(id))
+	}
+	if s.ProtocolVersion == MQTTv5 {
+		body = append(body, 0) // No properties.
+	}
+	body = append(body, payload...)
+	if err := s.send(mqttPacket(header, body)); err != nil {
+		return err
+	}
+
+	switch s.QoS {
+	case 1:
+		return s.awaitAck(mqttPuback, id)
+	case 2:
+		if err := s.awaitAck(mqttPubrec, id); err != nil {
+			return err
+		}
+		if err := s.send(mqttPacket(mqttPubrel, []byte{byte(id >> 8), byte(id)})); err != nil {
+			return err
+		}
+		return s.awaitAck(mqttPubcomp, id)
+	}
+	return nil
+}
+
+// awaitAck reads packets until the acknowledgement of the given type and packet identifier arrives.
+// Keep-alive responses and unrelated packets are skipped. The caller must hold the lock.
+func (s *MQTTSink) awaitAck(packetType byte, id uint16) error {
+	for {
+		header, body, err := s.readPacket()
+		if err != nil {
+			return fmt.Errorf("error waiting for mqtt acknowledgement: %w", err)
+		}
+		if header&0xF0 != packetType&0xF0 || len(body) < 2 || uint16(body[0])<<8|uint16(body[1]) != id {
+			continue
+		}
+		// MQTT 5 acknowledgements may carry a reason code; codes of 0x80 and above are failures.
+		if s.ProtocolVersion == MQTTv5 && len(body) > 2 && body[2] >= 0x80 {
+			return fmt.Errorf("mqtt broker rejected message %d with reason 0x%02x", id, body[2])
+		}
+		return nil
+	}
+}
+
+// keepAlive pings the broker whenever nothing has been received from it for half the keep-alive
+// interval, so slow real-time runs are not disconnected, and a connection that broke without being
+// closed is noticed even at QoS 0, where the broker sends nothing else. A failed or unanswered ping
+// drops the connection, which is re-established by the next write.
+func (s *MQTTSink) keepAlive(stop <-chan struct{}) {
+	ticker := time.NewTicker(s.KeepAlive / 2)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.conn != nil && time.Since(s.lastRead) >= s.KeepAlive/2 {
+				if err := s.ping(); err != nil {
+					s.Logger.Warn("Error pinging MQTT broker", "broker", s.Broker, "error", err)
+					s.closeConn()
+				}
+			}
+			s.mu.Unlock()
+		}
+	}
+}
+
+// ping sends a PINGREQ and waits for the PINGRESP, for at most half the keep-alive interval so
+// that the wait ends before the next ping is due. The caller must hold the lock.
+func (s *MQTTSink) ping() error {
+	if err := s.send(mqttPacket(mqttPingreq, nil)); err != nil {
+		return err
+	}
+	deadline := time.Now().Add(min(s.KeepAlive/2, mqttTimeout))
+	for {
+		header, _, err := s.readPacketBefore(deadline)
+		if err != nil {
+			return fmt.Errorf("no mqtt ping response: %w", err)
+		}
+		if header&0xF0 == mqttPingresp {
+			return nil
+		}
+	}
+}
+
+// send writes a complete packet to the connection. The caller must hold the lock.
+func (s *MQTTSink) send(packet []byte) error {
+	if err := s.conn.SetWriteDeadline(time.Now().Add(mqttTimeout)); err != nil {
+		return err
+	}
+	if _, err := s.conn.Write(packet); err != nil {
+		return fmt.Errorf("error writing to mqtt broker: %w", err)
+	}
+	return nil
+}
+
+// readPacket reads one packet other than a keep-alive response and returns its fixed header byte and
+// body. The caller must hold the lock.
+func (s *MQTTSink) readPacket() (byte, []byte, error) {
+	for {
+		header, body, err := s.readPacketBefore(time.Now().Add(mqttTimeout))
+		if err != nil || header&0xF0 != mqttPingresp {
+			return header, body, err
+		}
+	}
+}
+
+// readPacketBefore reads one packet, failing if it has not arrived by the deadline, and returns its
+// fixed header byte and body. The caller must hold the lock.
+func (s *MQTTSink) readPacketBefore(deadline time.Time) (byte, []byte, error) {
+	if err := s.conn.SetReadDeadline(deadline); err != nil {
+		return 0, nil, err
+	}
+	header, err := s.reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	// The remaining length is a variable byte integer of at most four bytes.
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		b, err := s.reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		if i == 3 {
+			return 0, nil, fmt.Errorf("malformed mqtt remaining length")
+		}
+		multiplier *= 128
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(s.reader, body); err != nil {
+		return 0, nil, err
+	}
+	s.lastRead = time.Now()
+	return header, body, nil
+}
+
+// closeConn drops the current connection without a DISCONNECT. The caller must hold the lock.
+func (s *MQTTSink) closeConn() {
+	if s.conn != nil {
+		_ = s.conn.Close()
+		s.conn = nil
+	}
+}
+
+// nextPacketID returns the next non-zero packet identifier. The caller must hold the lock.
+func (s *MQTTSink) nextPacketID() uint16 {
+	s.packetID++
+	if s.packetID == 0 {
+		s.packetID = 1
+	}
+	return s.packetID
+}
+
+// mqttPacket prefixes a packet body with its fixed header and remaining length.
+func mqttPacket(header byte, body []byte) []byte {
+	packet := []byte{header}
+	length := len(body)
+	for {
+		b := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			b |= 0x80
+		}
+		packet = append(packet, b)
+		if length == 0 {
+			break
+		}
+	}
+	return append(packet, body...)
+}
+
+// appendMQTTString appends a length-prefixed UTF-8 string.
+func appendMQTTString(dst []byte, s string) []byte {
+	dst = append(dst, byte(len(s)>>8), byte(len(s)))
+	return append(dst, s...)
+}
+
+// hostWithPort returns the host and port of a broker URL, using the default port if none is given.
+func hostWithPort(broker *url.URL, defaultPort string) string {
+	if broker.Port() != "" {
+		return broker.Host
+	}
+	return net.JoinHostPort(broker.Hostname(), defaultPort)
+}
+
+// mqttTopicFields lists the placeholders of topic templates and the sensor fields replacing them.
+var mqttTopicFields = []struct {
+	name  string
+	value func(Sensor) string
+}{
+	{"name", func(s Sensor) string { return s.Name }},
+	{"id", func(s Sensor) string { return s.ID }},
+	{"version", func(s Sensor) string { return s.Version }},
+	{"location", func(s Sensor) string { return s.Location }},
+}
+
+// mqttTopic builds the topic of a sensor's readings from a topic template. The sensor fields used by
+// the template must neither be empty nor contain the wildcards "+" and "#", the level separator "/"
+// or a null character, which brokers reject or which would move the readings to another level of the
+// topic hierarchy.
+func mqttTopic(template string, sensor Sensor) (string, error) {
+	var replacements []string
+	for _, field := range mqttTopicFields {
+		placeholder := "{" + field.name + "}"
+		if !strings.Contains(template, placeholder) {
+			continue
+		}
+		value := field.value(sensor)
+		if value == "" {
+			return "", fmt.Errorf("sensor %s used in mqtt topic %s must not be empty", field.name, template)
+		}
+		if strings.ContainsAny(value, "+#/\x00") {
+			return "", fmt.Errorf(`sensor %s %q used in mqtt topic %s must not contain "+", "#", "/" or a null character`, field.name, value, template)
+		}
+		replacements = append(replacements, placeholder, value)
+	}
+	return strings.NewReplacer(replacements...).Replace(template), nil
+}
+
+// newMQTTSink creates an MQTT sink from its configuration, loading the trusted CA certificates if set.
+func newMQTTSink(sinkConfig SinkConfig, logger *slog.Logger) (*MQTTSink, error) {
+	if sinkConfig.URL == "" {
+		return nil, fmt.Errorf("mqtt sink requires a broker url")
+	}
+	if strings.ContainsAny(sinkConfig.Topic, "+#") {
+		return nil, fmt.Errorf("mqtt topic must not contain wildcards: %s", sinkConfig.Topic)
+	}
+	if sinkConfig.QoS < 0 || sinkConfig.QoS > 2 {
+		return nil, fmt.Errorf("invalid mqtt qos %d: must be 0, 1 or 2", sinkConfig.QoS)
+	}
+	version, err := parseMQTTVersion(sinkConfig.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	var tlsConfig *tls.Config
+	if sinkConfig.CAFile != "" || sinkConfig.InsecureSkipVerify {
+		broker, err := url.Parse(sinkConfig.URL)
+		if err != nil {
+			return nil, fmt.Errorf("invalid mqtt broker url %q: %w", sinkConfig.URL, err)
+		}
+		tlsConfig = &tls.Config{
+			ServerName:         broker.Hostname(),
+			InsecureSkipVerify: sinkConfig.InsecureSkipVerify,
+		}
+		if sinkConfig.CAFile != "" {
+			pem, err := os.ReadFile(sinkConfig.CAFile)
+			if err != nil {
+				return nil, fmt.Errorf("unable to read mqtt CA file: %w", err)
+			}
+			tlsConfig.RootCAs = x509.NewCertPool()
+			if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+				return nil, fmt.Errorf("no certificates found in mqtt CA file %s", sinkConfig.CAFile)
+			}
+		}
+	}
+
+	if sinkConfig.MaxRetries != nil && *sinkConfig.MaxRetries < 0 {
+		return nil, fmt.Errorf("mqtt sink maxRetries must not be negative, got %d", *sinkConfig.MaxRetries)
+	}
+
+	return &MQTTSink{
+		Broker:          sinkConfig.URL,
+		Topic:           sinkConfig.Topic,
+		ClientID:        sinkConfig.ClientID,
+		QoS:             byte(sinkConfig.QoS),
+		Retain:          sinkConfig.Retain,
+		ProtocolVersion: version,
+		Username:        sinkConfig.Username,
+		Password:        sinkConfig.Password,
+		TLSConfig:       tlsConfig,
+		MaxReconnects:   sinkConfig.MaxRetries,
+		Logger:          logger,
+	}, nil
+}
+
+// parseMQTTVersion converts a configured protocol version such as "3.1.1" or "5" to a protocol level.
+func parseMQTTVersion(version string) (byte, error) {
+	switch version {
+	case "", "3.1.1", "4":
+		return MQTTv311, nil
+	case "5", "5.0":
+		return MQTTv5, nil
+	default:
+		return 0, fmt.Errorf("unsupported mqtt protocol version: %s", version)
+	}
+}
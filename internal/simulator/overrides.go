@@ -0,0 +1,186 @@
+package simulator
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// EnvPrefix is the prefix of the environment variables that override configuration settings.
+const EnvPrefix = "TEMPSIM_"
+
+// ConfigOption describes a configuration setting that can be overridden by an environment variable
+// or a command-line flag, which take precedence over the configuration file in that order.
+type ConfigOption struct {
+	Key   string // JSON key of the setting, e.g. "totalReadings".
+	Env   string // Environment variable, e.g. "TEMPSIM_TOTAL_READINGS".
+	Flag  string // Command-line flag without the dash, e.g. "total_readings".
+	Usage string // Description of the setting for the flag usage.
+	Bool  bool   // Whether the setting is a boolean, whose flag may be given without a value.
+}
+
+// configOptions lists every Config field in declaration order. Environment variables and flags are
+// derived from the JSON key, unless given here to keep the names of older flags.
+var configOptions = []ConfigOption{
+	{Key: "totalReadings", Usage: "Number of readings per sensor; 0 runs until duration, until or cancellation"},
+	{Key: "duration", Usage: "Length of the run in simulated time (e.g. 24h)"},
+	{Key: "until", Usage: "RFC 3339 simulated time at which the run ends"},
+	{Key: "startingTemp", Usage: "Initial temperature of all sensors"},
+	{Key: "maxTempIncrease", Usage: "Maximum temperature increase during the increase period"},
+	{Key: "tempFluctuation", Usage: "Maximum random fluctuation applied to the temperature"},
+	{Key: "minTemp", Usage: "Minimum temperature"},
+	{Key: "maxTemp", Usage: "Maximum temperature"},
+	{Key: "outputFileName", Env: "TEMPSIM_OUTPUT_FILE", Flag: "output_file", Usage: "Output file for temperature readings"},
+	{Key: "mode", Usage: "Run mode (backfill, realtime, accelerated)"},
+	{Key: "timeScale", Usage: "Speed of simulated time in accelerated mode (e.g. 60 for one simulated hour per minute)"},
+	{Key: "simulate", Usage: "Deprecated: use mode"},
+	{Key: "logFilePath", Env: "TEMPSIM_LOG_OUTPUT", Flag: "log_output", Usage: "Log output ('stdout', 'stderr' or file path)"},
+	{Key: "seed", Usage: "Random seed for reproducible runs; 0 picks a time-based seed"},
+	{Key: "startTime", Usage: "RFC 3339 start time of a simulated run"},
+	{Key: "interval", Usage: "Time between two readings of a sensor (e.g. 1m)"},
+	{Key: "sinks", Usage: `Output sinks as a JSON array (e.g. '[{"type":"stdout"}]')`},
+	{Key: "outputFormat", Usage: "Format of file output (json, csv, line)"},
+	{Key: "csvColumns", Usage: "Comma-separated columns of CSV output"},
+	{Key: "csvDelimiter", Usage: "Single-character field delimiter of CSV output"},
+}
+
+// ConfigOptions returns the environment variable and flag of every configuration setting.
+func ConfigOptions() []ConfigOption {
+	options := make([]ConfigOption, len(configOptions))
+	config := reflect.ValueOf(Config{})
+	for i, option := range configOptions {
+		if option.Env == "" {
+			option.Env = EnvPrefix + strings.ToUpper(snakeCase(option.Key))
+		}
+		if option.Flag == "" {
+			option.Flag = snakeCase(option.Key)
+		}
+		if field, ok := configField(config, option.Key); ok {
+			option.Bool = field.Kind() == reflect.Bool
+		}
+		options[i] = option
+	}
+	return options
+}
+
+// snakeCase converts a camel-case JSON key such as "totalReadings" to "total_readings".
+func snakeCase(key string) string {
+	var b strings.Builder
+	for _, r := range key {
+		if unicode.IsUpper(r) {
+			b.WriteByte('_')
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// ApplyEnv overrides every setting whose environment variable is set, looking variables up with
+// lookup, which is usually os.LookupEnv. Set variables that are empty override the setting with its
+// zero value.
+//
+// Returns an error naming the variable if its value cannot be parsed.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, option := range ConfigOptions() {
+		value, ok := lookup(option.Env)
+		if !ok {
+			continue
+		}
+		if err := c.Set(option.Key, value); err != nil {
+			return fmt.Errorf("%s: %w", option.Env, err)
+		}
+	}
+	return nil
+}
+
+// Set parses value and assigns it to the setting with the given JSON key. Numbers, booleans and
+// strings are written as usual, durations as e.g. "10s", lists of strings separated by commas and
+// sinks as a JSON array.
+func (c *Config) Set(key, value string) error {
+	field, ok := configField(reflect.ValueOf(c).Elem(), key)
+	if !ok {
+		return fmt.Errorf("unknown configuration setting %s", key)
+	}
+	if err := setField(field, value); err != nil {
+		return fmt.Errorf("invalid value %q for %s: %w", value, key, err)
+	}
+	return nil
+}
+
+// durationType is the type of Duration, which is parsed from a duration string rather than a number.
+var durationType = reflect.TypeOf(Duration(0))
+
+// configField returns the field of a Config value that has the given JSON key.
+func configField(config reflect.Value, key string) (reflect.Value, bool) {
+	for i := 0; i < config.NumField(); i++ {
+		name, _, _ := strings.Cut(config.Type().Field(i).Tag.Get("json"), ",")
+		if name == key {
+			return config.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+// setField parses value according to the type of field and assigns it.
+func setField(field reflect.Value, value string) error {
+	if value == "" {
+		field.Set(reflect.Zero(field.Type()))
+		return nil
+	}
+	if field.Type() == durationType {
+		parsed, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		field.SetInt(int64(parsed))
+		return nil
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(value)
+	case reflect.Int, reflect.Int64:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		field.SetInt(parsed)
+	case reflect.Float64:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(parsed)
+	case reflect.Bool:
+		parsed, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		field.SetBool(parsed)
+	case reflect.Slice:
+		if field.Type().Elem().Kind() == reflect.String {
+			var items []string
+			for _, item := range strings.Split(value, ",") {
+				if item = strings.TrimSpace(item); item != "" {
+					items = append(items, item)
+				}
+			}
+			field.Set(reflect.ValueOf(items))
+			return nil
+		}
+		// Lists of objects, such as sinks, are written as JSON, and checked as strictly as the
+		// configuration file, so that misspelled keys are not silently ignored.
+		decoded := reflect.New(field.Type())
+		if _, err := decodeJSONConfig([]byte(value), decoded.Interface(), false, func(string, int64) string { return "" }); err != nil {
+			return err
+		}
+		field.Set(decoded.Elem())
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
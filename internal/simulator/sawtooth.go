@@ -0,0 +1,66 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"time"
+)
+
+const (
+	// defaultIncreaseCycle is the length of the cycle in which the temperature increase phase repeats.
+	defaultIncreaseCycle = time.Hour
+
+	// defaultIncreasePeriod defines how long at the start of each cycle the temperature is increased.
+	defaultIncreasePeriod = 5 * time.Minute
+)
+
+// sawtoothParams holds the parameters of the sawtooth model.
+type sawtoothParams struct {
+	Cycle          Duration `json:"cycle"`          // Length of the cycle in which the increase repeats; defaults to one hour.
+	IncreasePeriod Duration `json:"increasePeriod"` // How long at the start of each cycle the temperature rises; defaults to five minutes.
+}
+
+// sawtoothModel applies uniform random fluctuation of up to TempFluctuation to every reading, and
+// adds MaxTempIncrease during the increase period at the start of every cycle of simulated time,
+// regardless of how often the sensor reads.
+type sawtoothModel struct {
+	cycle          time.Duration
+	increasePeriod time.Duration
+}
+
+// newSawtoothModel creates a sawtooth model from its parameters.
+func newSawtoothModel(params json.RawMessage) (Model, error) {
+	p := sawtoothParams{Cycle: Duration(defaultIncreaseCycle), IncreasePeriod: Duration(defaultIncreasePeriod)}
+	if err := decodeModelParams(params, &p); err != nil {
+		return nil, err
+	}
+	switch {
+	case p.Cycle <= 0:
+		return nil, fmt.Errorf("cycle must be positive, got %s", time.Duration(p.Cycle))
+	case p.IncreasePeriod <= 0 || p.IncreasePeriod > p.Cycle:
+		return nil, fmt.Errorf("increasePeriod must be positive and at most the cycle, got %s", time.Duration(p.IncreasePeriod))
+	}
+	return &sawtoothModel{cycle: time.Duration(p.Cycle), increasePeriod: time.Duration(p.IncreasePeriod)}, nil
+}
+
+// Next applies the fluctuation and the share of the increase that falls within the reading's interval.
+func (m *sawtoothModel) Next(state ModelState, r *rand.Rand) float64 {
+	fluctuation := r.Float64()*2*state.Params.TempFluctuation - state.Params.TempFluctuation
+	increase := m.overlap(state.Elapsed-state.Interval, state.Elapsed).Seconds() / m.increasePeriod.Seconds()
+	return state.Temperature + fluctuation + state.Params.MaxTempIncrease*increase
+}
+
+// overlap returns how much of the simulated time between `from` and `to`, both measured from the
+// start of the run, falls within the increase period at the start of each cycle.
+func (m *sawtoothModel) overlap(from, to time.Duration) time.Duration {
+	var overlap time.Duration
+	for cycle := from - from%m.cycle; cycle < to; cycle += m.cycle {
+		start := max(from, cycle)
+		end := min(to, cycle+m.increasePeriod)
+		if end > start {
+			overlap += end - start
+		}
+	}
+	return overlap
+}
@@ -3,12 +3,13 @@
 package simulator
 
 import (
-	"bufio"
+	"container/heap"
+	"context"
 	"encoding/json"
 	"fmt"
-	"log"
+	"log/slog"
+	"math"
 	"math/rand"
-	"os"
 	"strconv"
 	"time"
 )
@@ -17,15 +18,24 @@ import (
 // It allows for custom JSON marshaling and unmarshaling to handle temperature formatting.
 type Temperature float64
 
-// MarshalJSON formats Temperature values with two decimal places when encoding to JSON.
+// MarshalJSON formats Temperature values with two decimal places when encoding to JSON. Values that
+// are not a number, such as those of injected faults, are encoded as null.
 func (t Temperature) MarshalJSON() ([]byte, error) {
+	if math.IsNaN(float64(t)) || math.IsInf(float64(t), 0) {
+		return []byte("null"), nil
+	}
 	formattedTemp := strconv.FormatFloat(float64(t), 'f', 2, 64)
 	return []byte(formattedTemp), nil
 }
 
 // UnmarshalJSON parses JSON data to populate a Temperature value.
-// It expects the JSON data to be a float64 and converts it to the Temperature type.
+// It expects the JSON data to be a float64 and converts it to the Temperature type; null is decoded
+// as not a number.
 func (t *Temperature) UnmarshalJSON(b []byte) error {
+	if string(b) == "null" {
+		*t = Temperature(math.NaN())
+		return nil
+	}
 	temp, err := strconv.ParseFloat(string(b), 64)
 	if err != nil {
 		return err
@@ -37,26 +47,83 @@ func (t *Temperature) UnmarshalJSON(b []byte) error {
 // TemperatureReading represents a single temperature reading from a sensor.
 // It contains the time of the reading, the temperature value, and sensor metadata.
 type TemperatureReading struct {
-	Time        string      `json:"time"`        // Time of the reading in UTC format.
-	Temperature Temperature `json:"temperature"` // The measured temperature value.
-	Sensor      Sensor      `json:"sensor"`      // Metadata about the sensor making the reading.
+	Time        string      `json:"time"`            // Time of the reading in UTC format.
+	Temperature Temperature `json:"temperature"`     // The measured temperature value.
+	Sensor      Sensor      `json:"sensor"`          // Metadata about the sensor making the reading.
+	Seed        int64       `json:"seed"`            // Random seed of the run that produced the reading.
+	Fault       string      `json:"fault,omitempty"` // Types of the faults injected into the reading, e.g. "spike,drift".
+	Clamped     bool        `json:"-"`               // Whether the temperature was clamped to the min/max range.
+}
+
+// Timestamp parses the time of the reading, which is recorded in UTC.
+func (r TemperatureReading) Timestamp() (time.Time, error) {
+	return time.ParseInLocation(timeFormat, r.Time, time.UTC)
+}
+
+// sensorMetadata holds the identifying fields of a Sensor that are written with each reading.
+type sensorMetadata struct {
+	Name     string `json:"name"`
+	ID       string `json:"id"`
+	Version  string `json:"version"`
+	Location string `json:"location"`
+}
+
+// MarshalJSON encodes the reading with only the identifying metadata of its sensor, leaving out
+// per-sensor simulation settings such as the interval.
+func (r TemperatureReading) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Time        string         `json:"time"`
+		Temperature Temperature    `json:"temperature"`
+		Sensor      sensorMetadata `json:"sensor"`
+		Seed        int64          `json:"seed"`
+		Fault       string         `json:"fault,omitempty"`
+	}{
+		Time:        r.Time,
+		Temperature: r.Temperature,
+		Sensor: sensorMetadata{
+			Name:     r.Sensor.Name,
+			ID:       r.Sensor.ID,
+			Version:  r.Sensor.Version,
+			Location: r.Sensor.Location,
+		},
+		Seed:  r.Seed,
+		Fault: r.Fault,
+	})
 }
 
 const (
 	// timeFormat specifies the layout used for formatting timestamps in the simulation.
 	timeFormat = "2006-01-02 15:04:05"
 
-	// readingsPerHour defines how many readings are taken per hour.
-	readingsPerHour = 60
+	// timeFormatMillis is the timestamp layout used when a sensor reads more often than once per second.
+	timeFormatMillis = "2006-01-02 15:04:05.000"
+
+	// defaultInterval is the time between two readings when no interval is configured.
+	defaultInterval = 60 * time.Second
 
-	// increasePeriodMinutes defines how many minutes each hour the temperature is increased.
-	increasePeriodMinutes = 5
+	// defaultTimeScale is how many times faster than the clock simulated time advances in
+	// accelerated mode when no time scale is configured: one simulated hour per real minute.
+	defaultTimeScale = 60
 )
 
+// seededStartTime is the first simulated timestamp of a seeded run, so that replaying a seed
+// reproduces the timestamps as well as the temperatures.
+var seededStartTime = time.Date(2024, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// Generator produces temperature readings for a set of sensors according to a Config.
+// The Clock is used for the current time and for pacing real-time runs; when it is nil the
+// SystemClock is used. Tests can inject a fake clock to verify pacing without waiting.
+type Generator struct {
+	Sensors []Sensor     // Sensors for which readings are generated.
+	Config  Config       // Simulation settings applied to every sensor.
+	Clock   Clock        // Source of time for the simulation; defaults to SystemClock.
+	Logger  *slog.Logger // Logger for progress messages; defaults to the default logger.
+}
+
 // GenerateTemperatureReadings simulates temperature readings for the specified sensors.
 // It generates `totalReadings` temperature readings for each sensor, starting from `startingTemp`.
 // The function also models temperature fluctuation and optional temperature increases during a
-// predefined period (`increasePeriodMinutes`).
+// predefined period (`increasePeriod`).
 //
 // Parameters:
 //   - sensors: List of Sensor objects for which readings are generated.
@@ -66,7 +133,12 @@ const (
 //   - tempFluctuation: The maximum amount of random fluctuation applied to the temperature in each reading.
 //   - minTemp: The minimum allowable temperature value.
 //   - maxTemp: The maximum allowable temperature value.
-//   - simulate: If true, simulates readings over time; otherwise, fast-forwards the simulation.
+//   - simulate: If true, backfills the readings without waiting; otherwise, produces them in real time.
+//
+// It is a convenience wrapper around Generator using the system clock, the default logger and a
+// time-based seed; set Config.Seed on a Generator for reproducible runs. See Generator.Generate.
+// Unlike a Generator, which treats a run without totalReadings as a run without an end, it returns
+// no readings when `totalReadings` is zero.
 //
 // Returns a slice of `TemperatureReading` objects and an error (if applicable).
 func GenerateTemperatureReadings(
@@ -75,79 +147,406 @@ func GenerateTemperatureReadings(
 	startingTemp, maxTempIncrease, tempFluctuation, minTemp, maxTemp float64,
 	simulate bool,
 ) ([]TemperatureReading, error) {
+	if totalReadings == 0 {
+		return []TemperatureReading{}, nil
+	}
+	generator := &Generator{
+		Sensors: sensors,
+		Config: Config{
+			TotalReadings:   totalReadings,
+			StartingTemp:    startingTemp,
+			MaxTempIncrease: maxTempIncrease,
+			TempFluctuation: tempFluctuation,
+			MinTemp:         minTemp,
+			MaxTemp:         maxTemp,
+			Simulate:        simulate,
+		},
+	}
+	return generator.Generate()
+}
+
+// Generate simulates temperature readings for the generator's sensors and returns them all at once.
+// It is a convenience wrapper around Stream that collects every reading in memory; see Stream for
+// how the readings are produced.
+//
+// Returns a slice of `TemperatureReading` objects, or an error if the configuration is invalid or
+// the run has no end, since its readings would never fit in memory.
+func (g *Generator) Generate() ([]TemperatureReading, error) {
+	if g.Config.unbounded() {
+		return nil, fmt.Errorf("cannot collect the readings of a run without totalReadings, duration or until")
+	}
+
+	readings := make(chan TemperatureReading, 64)
+	errc := make(chan error, 1)
+	go func() {
+		errc <- g.Stream(context.Background(), readings)
+	}()
+
+	// The slice is not preallocated: TotalReadings is only checked by Stream, and a run bounded by
+	// Duration or Until may end well before it.
+	var data []TemperatureReading
+	for reading := range readings {
+		data = append(data, reading)
+	}
+	if err := <-errc; err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// Stream simulates temperature readings for the generator's sensors and sends each reading on `out`
+// as soon as it is produced, so that arbitrarily long runs need constant memory. It closes `out`
+// when it returns.
+//
+// It generates `TotalReadings` readings for each sensor, starting from `StartingTemp`. Each sensor
+// reads once per `Interval`, which defaults to the global interval and then to one minute, and the
+// readings of all sensors are sent in time order. Sensors may override the temperature parameters of
+// the configuration, see Sensor.Params.
+//
+// The temperatures of each sensor are produced by the model it selects, see Model, and clamped to
+// the sensor's `MinTemp` and `MaxTemp`. Faults configured for a sensor are then injected into its
+// readings, see FaultSpec, without affecting the model; readings with faults are tagged with their
+// types, and dropped readings are not sent.
+//
+// A run can also be bounded in simulated time: it ends `Duration` after its first timestamp or at
+// `Until`, whichever comes first, and no reading is scheduled after that point. When none of
+// `TotalReadings`, `Duration` and `Until` is set, the run continues until the context is cancelled.
+//
+// By default sensors use the sawtooth model: every reading fluctuates randomly by up to
+// `TempFluctuation`, and during the first five minutes of every hour of simulated time the
+// temperature is increased, so that `MaxTempIncrease` is added over that period regardless of how
+// often the sensors read.
+//
+// The run mode, see Config.RunMode, decides how readings are paced. In backfill mode every reading
+// is produced immediately. In real-time mode the generator waits on the clock until each reading is
+// due and stamps it with the time of the clock. In accelerated mode it waits as well, but simulated
+// time advances `TimeScale` times faster than the clock, 60 times by default.
+//
+// Waiting readings are released on a schedule computed from the start of the run rather than by
+// sleeping for an interval after each reading, so the time spent producing and writing readings does
+// not accumulate and long runs do not fall behind. A reading that is already late is sent at once.
+//
+// In backfill and accelerated mode the timestamps start at `StartTime` when it is set. Otherwise a
+// seeded run starts at a fixed point in time and an unseeded run starts at the current time of the
+// clock. In real-time mode `StartTime` is ignored.
+//
+// A non-zero seed makes a simulated run fully reproducible: the temperatures of each sensor are drawn
+// from a generator seeded with the seed and the sensor's position, and the timestamps start at a
+// fixed point in time. The effective seed is logged
+// and stored in every reading, and logged with the first timestamp, so that any simulated run can be
+// replayed by setting both `Seed` and `StartTime`.
+//
+// Returns an error if the configuration is invalid, or the context's error if it is cancelled
+// before all readings have been produced.
+func (g *Generator) Stream(ctx context.Context, out chan<- TemperatureReading) error {
+	defer close(out)
+
+	config := g.Config
+	clock := g.Clock
+	if clock == nil {
+		clock = SystemClock
+	}
+	logger := loggerOrDefault(g.Logger)
 
 	// Log the start of temperature generation
-	log.Printf("Starting temperature generation for %d sensors with %d readings each", len(sensors), totalReadings)
+	logger.Info("Starting temperature generation", "sensors", len(g.Sensors), "readingsPerSensor", config.TotalReadings)
 
-	// Initialize temperature values for each sensor.
-	sensorTemps := make([]float64, len(sensors))
-	for i := range sensors {
-		sensorTemps[i] = startingTemp
+	mode, err := config.RunMode()
+	if err != nil {
+		return err
 	}
 
-	// Preallocate data slice to avoid resizing in the loop.
-	data := make([]TemperatureReading, 0, totalReadings*len(sensors))
+	// Simulated time runs `TimeScale` times faster than the clock in accelerated mode.
+	timeScale := 1.0
+	switch {
+	case config.TimeScale < 0:
+		return fmt.Errorf("invalid time scale %g: must be positive", config.TimeScale)
+	case mode == ModeAccelerated && config.TimeScale > 0:
+		timeScale = config.TimeScale
+	case mode == ModeAccelerated:
+		timeScale = defaultTimeScale
+	case config.TimeScale > 0 && config.TimeScale != 1:
+		logger.Warn("Time scale is ignored outside accelerated mode", "timeScale", config.TimeScale)
+	}
+	logger.Info("Using run mode", "mode", mode, "timeScale", timeScale)
 
-	// Calculate the temperature increase per minute.
-	increaseAmountPerMinute := maxTempIncrease / float64(increasePeriodMinutes)
-	var currentTime time.Time
-	if simulate {
-		currentTime = time.Now().UTC()
+	// Parse the explicit start time, if provided.
+	var startTime time.Time
+	if config.StartTime != "" {
+		var err error
+		startTime, err = time.Parse(time.RFC3339, config.StartTime)
+		if err != nil {
+			return fmt.Errorf("invalid start time %q: %w", config.StartTime, err)
+		}
+		if mode == ModeRealtime {
+			logger.Warn("Start time is ignored in real-time mode", "startTime", config.StartTime)
+		}
 	}
 
-	// Create a random number generator with a seed based on the current time.
-	r := rand.New(rand.NewSource(time.Now().UnixNano()))
+	// Parse the end of the run, if provided.
+	if config.TotalReadings < 0 {
+		return fmt.Errorf("invalid total readings %d: must not be negative", config.TotalReadings)
+	}
+	if config.Duration < 0 {
+		return fmt.Errorf("invalid duration %s: must not be negative", time.Duration(config.Duration))
+	}
+	var until time.Time
+	if config.Until != "" {
+		until, err = time.Parse(time.RFC3339, config.Until)
+		if err != nil {
+			return fmt.Errorf("invalid until %q: %w", config.Until, err)
+		}
+	}
 
-	// Generate temperature readings for the required number of readings.
-	for loopCount := 0; loopCount < totalReadings; loopCount++ {
-		if !simulate {
-			// Sleep for 60 seconds between readings if real-time simulation is disabled.
-			time.Sleep(60 * time.Second)
+	// Resolve the reading interval of each sensor and pick a timestamp layout precise enough for it.
+	intervals, err := g.sensorIntervals()
+	if err != nil {
+		return err
+	}
+	layout := timeFormat
+	for _, interval := range intervals {
+		if interval%time.Second != 0 {
+			layout = timeFormatMillis
 		}
-		// Update the current time, depending on whether simulation is active.
-		if simulate {
-			currentTime = currentTime.Add(60 * time.Second)
-		} else {
-			currentTime = time.Now().UTC()
+	}
+
+	// Resolve the simulation parameters and model of each sensor and initialize its temperature.
+	params := make([]SensorParams, len(g.Sensors))
+	models := make([]Model, len(g.Sensors))
+	sensorTemps := make([]float64, len(g.Sensors))
+	for i, sensor := range g.Sensors {
+		params[i] = sensor.Params(config)
+		models[i], err = NewModel(sensor.Model)
+		if err != nil {
+			return fmt.Errorf("invalid model for sensor %s: %w", sensor.ID, err)
 		}
+		sensorTemps[i] = params[i].StartingTemp
+	}
 
-		// Determine if we're in the temperature increase phase.
-		increasePhase := loopCount%readingsPerHour < increasePeriodMinutes
+	// Pick the first timestamp: an explicit start time, a fixed time for seeded runs, or now.
+	seed := config.Seed
+	var currentTime time.Time
+	switch {
+	case mode == ModeRealtime:
+		currentTime = clock.Now().UTC()
+	case !startTime.IsZero():
+		currentTime = startTime.UTC()
+	case seed != 0:
+		currentTime = seededStartTime
+	default:
+		currentTime = clock.Now().UTC()
+	}
 
-		for i, sensor := range sensors {
-			temp := sensorTemps[i]
+	// Fall back to a time-based seed when none is provided.
+	if seed == 0 {
+		seed = clock.Now().UnixNano()
+	}
+	// Log the first timestamp as well, since replaying the seed alone starts an unseeded run at the
+	// fixed time of seeded runs.
+	logger.Info("Using random seed", "seed", seed, "startTime", currentTime.Format(time.RFC3339Nano))
 
-			// Apply random temperature fluctuation.
-			fluctuation := r.Float64()*2*tempFluctuation - tempFluctuation
-			temp += fluctuation
+	// Give the model of every sensor a random number generator of its own, derived from the effective
+	// seed and the sensor's index, so that adding or removing a sensor leaves the temperatures of the
+	// sensors before it unchanged.
+	generators := make([]*rand.Rand, len(g.Sensors))
+	for i := range g.Sensors {
+		generators[i] = rand.New(rand.NewSource(modelSeed(seed, i)))
+	}
 
-			// Apply a temperature increase if in the increase phase.
-			if increasePhase {
-				temp += increaseAmountPerMinute
+	// Create the fault injectors, which draw from generators of their own so that the models draw
+	// the same values with or without faults.
+	injectors := make([]*faultInjector, len(g.Sensors))
+	for i, sensor := range g.Sensors {
+		if len(sensor.Faults) > 0 {
+			injectors[i], err = newFaultInjector(sensor.Faults, seed, i)
+			if err != nil {
+				return fmt.Errorf("invalid fault for sensor %s: %w", sensor.ID, err)
 			}
+		}
+	}
+
+	// Readings are due on the clock relative to the start of the run, scaled by the time scale.
+	clockStart := clock.Now()
+	behind := false
+
+	// Work out where the run ends in simulated time, if it is bounded by time at all.
+	var end time.Time
+	if config.Duration > 0 {
+		end = currentTime.Add(time.Duration(config.Duration))
+	}
+	if !until.IsZero() && (end.IsZero() || until.Before(end)) {
+		end = until.UTC()
+	}
+	if config.unbounded() {
+		logger.Info("Generating readings until cancelled")
+	}
+
+	// scheduled reports whether a sensor that has produced `count` readings reads again at `due`.
+	scheduled := func(count int, due time.Time) bool {
+		return (config.TotalReadings == 0 || count < config.TotalReadings) && (end.IsZero() || !due.After(end))
+	}
 
-			// Ensure the temperature is within the specified min/max range.
-			if temp < minTemp {
-				temp = minTemp
-			} else if temp > maxTemp {
-				temp = maxTemp
+	// Schedule the first reading of every sensor one interval after the start.
+	schedule := make(readingSchedule, 0, len(g.Sensors))
+	for i := range g.Sensors {
+		if due := currentTime.Add(intervals[i]); scheduled(0, due) {
+			schedule = append(schedule, scheduledReading{sensor: i, due: due})
+		}
+	}
+	heap.Init(&schedule)
+
+	// Generate readings in time order until no sensor has a reading left, or forever in an unbounded run.
+	counts := make([]int, len(g.Sensors))
+	total, faulty, missing := 0, 0, 0
+	for schedule.Len() > 0 {
+		next := heap.Pop(&schedule).(scheduledReading)
+		i, interval := next.sensor, intervals[next.sensor]
+
+		// Wait until the reading is due, unless backfilling. Only real-time readings are stamped with
+		// the time of the clock; the others carry their scheduled, simulated time.
+		readingTime := next.due
+		if mode != ModeBackfill {
+			due := clockStart.Add(time.Duration(float64(next.due.Sub(currentTime)) / timeScale))
+			if wait := due.Sub(clock.Now()); wait > 0 {
+				select {
+				case <-clock.After(wait):
+				case <-ctx.Done():
+					logger.Info("Temperature generation cancelled", "readings", total)
+					return ctx.Err()
+				}
+				behind = false
+			} else if lag := -wait; !behind && lag > time.Duration(float64(interval)/timeScale) {
+				// Late readings are sent without waiting until the run is back on schedule.
+				logger.Warn("Falling behind schedule, sending late readings at once", "lag", lag)
+				behind = true
 			}
+			if mode == ModeRealtime {
+				readingTime = clock.Now().UTC()
+			}
+		}
 
-			// Store the updated temperature back to the sensor.
-			sensorTemps[i] = temp
+		// Let the sensor's model produce the next temperature.
+		p := params[i]
+		temp := models[i].Next(ModelState{
+			Temperature: sensorTemps[i],
+			Time:        readingTime,
+			Elapsed:     next.due.Sub(currentTime),
+			Interval:    interval,
+			Params:      p,
+		}, generators[i])
+
+		// Ensure the temperature is within the specified min/max range.
+		clamped := true
+		if temp < p.MinTemp {
+			temp = p.MinTemp
+		} else if temp > p.MaxTemp {
+			temp = p.MaxTemp
+		} else {
+			clamped = false
+		}
+
+		// Store the updated temperature back to the sensor.
+		sensorTemps[i] = temp
+
+		// Inject the sensor's faults into the reading only, so that its model carries on from the
+		// clean temperature.
+		reported, fault, dropped := temp, "", false
+		if injectors[i] != nil {
+			reported, fault, dropped = injectors[i].apply(temp, readingTime)
+			if fault != "" {
+				faulty++
+			}
+			if dropped {
+				missing++
+			}
+		}
 
-			// Create a new reading with the updated temperature and current time.
+		// Create a new reading with the updated temperature and current time, and emit it.
+		if !dropped {
 			reading := TemperatureReading{
-				Time:        currentTime.Format(timeFormat),
-				Temperature: Temperature(temp),
-				Sensor:      sensor,
+				Time:        readingTime.Format(layout),
+				Temperature: Temperature(reported),
+				Sensor:      g.Sensors[i],
+				Seed:        seed,
+				Fault:       fault,
+				Clamped:     clamped,
 			}
-			data = append(data, reading)
+			select {
+			case out <- reading:
+				total++
+			case <-ctx.Done():
+				logger.Info("Temperature generation cancelled", "readings", total)
+				return ctx.Err()
+			}
+		}
+
+		// Schedule the sensor's next reading if it still has readings left.
+		counts[i]++
+		if due := next.due.Add(interval); scheduled(counts[i], due) {
+			heap.Push(&schedule, scheduledReading{sensor: i, due: due})
 		}
 	}
 
-	log.Printf("Completed temperature generation. Total readings generated: %d", len(data))
-	return data, nil
+	if faulty > 0 {
+		logger.Info("Injected faults into readings", "faulty", faulty, "dropped", missing)
+	}
+	logger.Info("Completed temperature generation", "readings", total)
+	return nil
+}
+
+// sensorIntervals returns the reading interval of each sensor, falling back to the global interval
+// and then to the default of one minute. It returns an error if any interval is negative.
+func (g *Generator) sensorIntervals() ([]time.Duration, error) {
+	global := time.Duration(g.Config.Interval)
+	if global < 0 {
+		return nil, fmt.Errorf("invalid interval %s: must be positive", global)
+	}
+	if global == 0 {
+		global = defaultInterval
+	}
+
+	intervals := make([]time.Duration, len(g.Sensors))
+	for i, sensor := range g.Sensors {
+		interval := time.Duration(sensor.Interval)
+		if interval < 0 {
+			return nil, fmt.Errorf("invalid interval %s for sensor %s: must be positive", interval, sensor.ID)
+		}
+		if interval == 0 {
+			interval = global
+		}
+		intervals[i] = interval
+	}
+	return intervals, nil
+}
+
+// scheduledReading is a pending reading of the sensor at the given index.
+type scheduledReading struct {
+	sensor int       // Index of the sensor in the generator's sensor list.
+	due    time.Time // Simulated time at which the reading is due.
+}
+
+// readingSchedule is a min-heap of pending readings ordered by due time and then by sensor index,
+// so that sensors reading at the same time are processed in configuration order.
+type readingSchedule []scheduledReading
+
+func (s readingSchedule) Len() int      { return len(s) }
+func (s readingSchedule) Swap(i, j int) { s[i], s[j] = s[j], s[i] }
+func (s readingSchedule) Less(i, j int) bool {
+	if !s[i].due.Equal(s[j].due) {
+		return s[i].due.Before(s[j].due)
+	}
+	return s[i].sensor < s[j].sensor
+}
+
+// Push adds a pending reading to the schedule; it is called by container/heap.
+func (s *readingSchedule) Push(x any) { *s = append(*s, x.(scheduledReading)) }
+
+// Pop removes the last pending reading from the schedule; it is called by container/heap.
+func (s *readingSchedule) Pop() any {
+	old := *s
+	item := old[len(old)-1]
+	*s = old[:len(old)-1]
+	return item
 }
 
 // SaveToJSON writes the temperature readings to a file in NDJSON (newline-delimited JSON) format.
@@ -156,50 +555,60 @@ func GenerateTemperatureReadings(
 // Parameters:
 //   - data: The temperature readings to write.
 //   - filename: The name of the file to save the readings to.
+//   - logger: The logger for progress messages; nil uses the default logger.
 //
 // Returns an error if the file cannot be created or written to.
-func SaveToJSON(data []TemperatureReading, filename string) error {
-	// Create the output file for writing.
-	log.Printf("Saving data to JSON file: %s", filename)
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Printf("Error creating file: %v", err)
-		return fmt.Errorf("error creating JSON file: %w", err)
+func SaveToJSON(data []TemperatureReading, filename string, logger *slog.Logger) error {
+	logger = loggerOrDefault(logger)
+	logger.Info("Saving data to JSON file", "file", filename)
+	sink := &JSONSink{Path: filename}
+	if err := sink.Open(); err != nil {
+		return err
 	}
-	defer func() {
-		if cerr := file.Close(); cerr != nil {
-			log.Printf("Error closing JSON file: %v", cerr)
-		}
-	}()
-
-	// Use a buffered writer for improved performance.
-	writer := bufio.NewWriterSize(file, 4096)
-	defer func() {
-		if err := writer.Flush(); err != nil {
-			log.Printf("Error flushing JSON writer: %v", err)
-		}
-	}()
 
-	// Write each temperature reading to the file as a JSON object.
 	for _, reading := range data {
-		// Marshal the reading to JSON format.
-		jsonData, err := json.Marshal(reading)
-		if err != nil {
-			log.Printf("Error encoding JSON: %v", err)
-			return fmt.Errorf("error encoding JSON data: %w", err)
-		}
-
-		// Write the JSON data followed by a newline.
-		if _, err := writer.Write(jsonData); err != nil {
-			log.Printf("Error writing JSON data: %v", err)
-			return fmt.Errorf("error writing JSON data: %w", err)
-		}
-		if err := writer.WriteByte('\n'); err != nil {
-			log.Printf("Error writing newline: %v", err)
-			return fmt.Errorf("error writing newline: %w", err)
+		if err := sink.Write(reading); err != nil {
+			_ = sink.Close()
+			return err
 		}
 	}
+	if err := sink.Close(); err != nil {
+		return err
+	}
 
-	log.Printf("Data successfully saved to %s", filename)
+	logger.Info("Data successfully saved", "file", filename)
 	return nil
 }
+
+// StreamToJSON writes temperature readings to a file in NDJSON format as they arrive on the channel,
+// until the channel is closed. Output is flushed whenever no further reading is waiting, so that
+// readings from a real-time run reach the file as soon as they are produced.
+//
+// Parameters:
+//   - readings: The channel delivering the temperature readings to write.
+//   - filename: The name of the file to save the readings to.
+//   - logger: The logger for progress messages; nil uses the default logger.
+//
+// Returns the number of readings written, and an error if the file cannot be created or written to.
+// On error the caller is responsible for stopping the producer of the readings.
+func StreamToJSON(readings <-chan TemperatureReading, filename string, logger *slog.Logger) (int, error) {
+	logger = loggerOrDefault(logger)
+
+	// Create the output file for writing.
+	logger.Info("Saving data to JSON file", "file", filename)
+	sink := &JSONSink{Path: filename}
+	if err := sink.Open(); err != nil {
+		return 0, err
+	}
+
+	count, err := WriteAll(sink, readings)
+	if cerr := sink.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return count, err
+	}
+
+	logger.Info("Data successfully saved", "file", filename)
+	return count, nil
+}
@@ -0,0 +1,452 @@
+package simulator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink is a destination for temperature readings.
+// A sink is opened once, receives readings one at a time, is flushed whenever buffered readings
+// should be delivered, and is closed at the end of the run. Close flushes any buffered readings.
+type Sink interface {
+	Open() error
+	Write(reading TemperatureReading) error
+	Flush() error
+	Close() error
+}
+
+// Stopper is implemented by sinks that wait between retries of a failed write. Stop makes them give
+// up waiting, so that a shutdown is not held up by a retry schedule; the write being retried then
+// fails. Stop may be called from any goroutine, and more than once.
+type Stopper interface {
+	Stop()
+}
+
+// retryWait lets the waits between retries of a sink be interrupted. The zero value is ready to use.
+type retryWait struct {
+	init    sync.Once
+	stop    sync.Once
+	stopped chan struct{}
+}
+
+// channel returns the channel that is closed once waiting is interrupted.
+func (w *retryWait) channel() chan struct{} {
+	w.init.Do(func() { w.stopped = make(chan struct{}) })
+	return w.stopped
+}
+
+// interrupt ends the current wait, if any, and makes every further wait return at once.
+func (w *retryWait) interrupt() {
+	stopped := w.channel()
+	w.stop.Do(func() { close(stopped) })
+}
+
+// sleep waits for d, or until interrupted. It reports whether the whole duration passed.
+func (w *retryWait) sleep(d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-w.channel():
+		return false
+	}
+}
+
+// SinkConfig describes one output destination in the configuration file.
+type SinkConfig struct {
+	Type      string `json:"type"`                // Kind of sink: "file", "stdout", "http", "influx" or "mqtt".
+	Path      string `json:"path,omitempty"`      // File path for "file" sinks; defaults to the output file name.
+	Format    string `json:"format,omitempty"`    // Output format of "file" and "stdout" sinks, overriding outputFormat.
+	URL       string `json:"url,omitempty"`       // Endpoint of "http" and "influx" sinks, or broker URL of "mqtt" sinks.
+	BatchSize int    `json:"batchSize,omitempty"` // Number of readings per HTTP request; defaults to 500.
+
+	Measurement string `json:"measurement,omitempty"` // Line protocol measurement name; defaults to "temperature".
+	Org         string `json:"org,omitempty"`         // InfluxDB organization for "influx" sinks.
+	Bucket      string `json:"bucket,omitempty"`      // InfluxDB bucket for "influx" sinks.
+	Token       string `json:"token,omitempty"`       // InfluxDB API token for "influx" sinks.
+	MaxRetries  *int   `json:"maxRetries,omitempty"`  // Retries of a failed "influx" request, or reconnects of "mqtt" sinks.
+	Gzip        bool   `json:"gzip,omitempty"`        // Compress "influx" request bodies with gzip.
+
+	Topic              string `json:"topic,omitempty"`              // Topic template of "mqtt" sinks, e.g. "plant/{location}/{id}/temperature".
+	QoS                int    `json:"qos,omitempty"`                // MQTT quality of service: 0, 1 or 2.
+	Retain             bool   `json:"retain,omitempty"`             // Ask the MQTT broker to retain the last message of each topic.
+	ClientID           string `json:"clientId,omitempty"`           // MQTT client identifier; defaults to a generated one.
+	ProtocolVersion    string `json:"protocolVersion,omitempty"`    // MQTT protocol version, "3.1.1" or "5"; defaults to "3.1.1".
+	Username           string `json:"username,omitempty"`           // Username for MQTT authentication.
+	Password           string `json:"password,omitempty"`           // Password for MQTT authentication.
+	CAFile             string `json:"caFile,omitempty"`             // PEM file with CA certificates trusted for TLS brokers.
+	InsecureSkipVerify bool   `json:"insecureSkipVerify,omitempty"` // Skip verification of the broker's TLS certificate.
+}
+
+const (
+	// defaultHTTPBatchSize is the number of readings sent per request when no batch size is configured.
+	defaultHTTPBatchSize = 500
+
+	// httpTimeout bounds the duration of a single request made by an HTTP sink.
+	httpTimeout = 30 * time.Second
+)
+
+// NewSinks creates the sinks listed in the configuration, combined into a single Sink.
+// When no sinks are configured the readings are written to the output file name, as in earlier versions.
+//
+// Sinks that report progress, such as retries and reconnects, log to the given logger; nil uses the
+// default logger.
+//
+// Returns an error if any sink configuration is invalid.
+func NewSinks(config Config, logger *slog.Logger) (Sink, error) {
+	sinkConfigs := config.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []SinkConfig{{Type: "file"}}
+	}
+
+	sinks := make([]Sink, 0, len(sinkConfigs))
+	for i, sinkConfig := range sinkConfigs {
+		sink, err := NewSink(sinkConfig, config, logger)
+		if err != nil {
+			return nil, fmt.Errorf("sinks[%d]: %w", i, err)
+		}
+		sinks = append(sinks, sink)
+	}
+	if len(sinks) == 1 {
+		return sinks[0], nil
+	}
+	return NewMultiSink(sinks...), nil
+}
+
+// NewSink creates a single sink from its configuration.
+// The global configuration provides the path of file sinks that do not set their own, as well as
+// the default output format and CSV settings.
+//
+// Returns an error if the sink type, format or a CSV column is unknown or a required setting is missing.
+func NewSink(sinkConfig SinkConfig, config Config, logger *slog.Logger) (Sink, error) {
+	switch sinkConfig.Type {
+	case "file", "":
+		path := sinkConfig.Path
+		if path == "" {
+			path = config.OutputFileName
+		}
+		if path == "" {
+			return nil, fmt.Errorf("file sink requires a path or an output file name")
+		}
+		return newFormattedSink(path, sinkConfig, config)
+	case "stdout":
+		return newFormattedSink("stdout", sinkConfig, config)
+	case "http":
+		if sinkConfig.URL == "" {
+			return nil, fmt.Errorf("http sink requires a url")
+		}
+		return &HTTPSink{URL: sinkConfig.URL, BatchSize: sinkConfig.BatchSize, Logger: logger}, nil
+	case "influx":
+		if sinkConfig.URL == "" {
+			return nil, fmt.Errorf("influx sink requires a url")
+		}
+		if sinkConfig.Bucket == "" {
+			return nil, fmt.Errorf("influx sink requires a bucket")
+		}
+		if sinkConfig.MaxRetries != nil && *sinkConfig.MaxRetries < 0 {
+			return nil, fmt.Errorf("influx sink maxRetries must not be negative, got %d", *sinkConfig.MaxRetries)
+		}
+		return &InfluxSink{
+			URL:         sinkConfig.URL,
+			Org:         sinkConfig.Org,
+			Bucket:      sinkConfig.Bucket,
+			Token:       sinkConfig.Token,
+			Measurement: sinkConfig.Measurement,
+			BatchSize:   sinkConfig.BatchSize,
+			MaxRetries:  sinkConfig.MaxRetries,
+			Gzip:        sinkConfig.Gzip,
+			Logger:      logger,
+		}, nil
+	case "mqtt":
+		return newMQTTSink(sinkConfig, logger)
+	default:
+		return nil, fmt.Errorf("unknown sink type: %s", sinkConfig.Type)
+	}
+}
+
+// Output formats supported by file and stdout sinks.
+const (
+	FormatJSON = "json" // Newline-delimited JSON, one reading per line.
+	FormatCSV  = "csv"  // Comma-separated values with a header row.
+	FormatLine = "line" // InfluxDB line protocol.
+)
+
+// outputFormat determines the format of a file or stdout sink. An explicit format wins; otherwise
+// the format is derived from the file extension, defaulting to JSON.
+func outputFormat(format, path string) (string, error) {
+	if format == "" {
+		switch strings.ToLower(filepath.Ext(path)) {
+		case ".csv":
+			return FormatCSV, nil
+		case ".lp":
+			return FormatLine, nil
+		default:
+			return FormatJSON, nil
+		}
+	}
+
+	switch strings.ToLower(format) {
+	case FormatJSON, "ndjson":
+		return FormatJSON, nil
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatLine, "influx":
+		return FormatLine, nil
+	default:
+		return "", fmt.Errorf("unknown output format: %s", format)
+	}
+}
+
+// newFormattedSink creates a sink writing to a file or to stdout in the configured output format.
+func newFormattedSink(path string, sinkConfig SinkConfig, config Config) (Sink, error) {
+	format := sinkConfig.Format
+	if format == "" {
+		format = config.OutputFormat
+	}
+	format, err := outputFormat(format, path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case FormatCSV:
+		delimiter, err := parseDelimiter(config.CSVDelimiter)
+		if err != nil {
+			return nil, err
+		}
+		// Check the columns now, so that a typo is reported before any sink is opened.
+		if _, err := csvColumnFields(config.CSVColumns); err != nil {
+			return nil, err
+		}
+		return &CSVSink{Path: path, Columns: config.CSVColumns, Delimiter: delimiter}, nil
+	case FormatLine:
+		return &LineProtocolSink{Path: path, Measurement: sinkConfig.Measurement}, nil
+	}
+	return &JSONSink{Path: path}, nil
+}
+
+// WriteAll writes every reading received on the channel to the sink until the channel is closed.
+// The sink is flushed whenever no further reading is waiting, so that readings from a real-time run
+// are delivered as soon as they are produced. The sink must already be open; WriteAll does not close it.
+//
+// Returns the number of readings written, and an error if the sink fails.
+// On error the caller is responsible for stopping the producer of the readings.
+func WriteAll(sink Sink, readings <-chan TemperatureReading) (int, error) {
+	count := 0
+	for reading := range readings {
+		if err := sink.Write(reading); err != nil {
+			return count, err
+		}
+		count++
+
+		// Flush when the producer has nothing else ready, so slow runs are written promptly.
+		if len(readings) == 0 {
+			if err := sink.Flush(); err != nil {
+				return count, err
+			}
+		}
+	}
+	return count, sink.Flush()
+}
+
+// writeJSONLine encodes a reading as a single line of NDJSON.
+func writeJSONLine(w io.Writer, reading TemperatureReading) error {
+	jsonData, err := json.Marshal(reading)
+	if err != nil {
+		return fmt.Errorf("error encoding JSON data: %w", err)
+	}
+	jsonData = append(jsonData, '\n')
+	if _, err := w.Write(jsonData); err != nil {
+		return fmt.Errorf("error writing JSON data: %w", err)
+	}
+	return nil
+}
+
+// JSONSink writes readings in NDJSON (newline-delimited JSON) format to a file, or to standard
+// output when the path is "stdout".
+type JSONSink struct {
+	Path string // Path of the output file, or "stdout".
+
+	file   *os.File
+	writer *bufio.Writer
+}
+
+// Open creates the output file, truncating it if it already exists.
+func (s *JSONSink) Open() error {
+	if s.Path == "stdout" {
+		s.writer = bufio.NewWriterSize(os.Stdout, 4096)
+		return nil
+	}
+
+	file, err := os.Create(s.Path)
+	if err != nil {
+		return fmt.Errorf("error creating JSON file: %w", err)
+	}
+	s.file = file
+
+	// Use a buffered writer for improved performance.
+	s.writer = bufio.NewWriterSize(file, 4096)
+	return nil
+}
+
+// Write appends the reading to the output as a JSON object followed by a newline.
+func (s *JSONSink) Write(reading TemperatureReading) error {
+	return writeJSONLine(s.writer, reading)
+}
+
+// Flush writes any buffered readings to the output.
+func (s *JSONSink) Flush() error {
+	if err := s.writer.Flush(); err != nil {
+		return fmt.Errorf("error flushing JSON data: %w", err)
+	}
+	return nil
+}
+
+// Close flushes the buffered readings and closes the output file.
+func (s *JSONSink) Close() error {
+	err := s.Flush()
+	if s.file != nil {
+		if cerr := s.file.Close(); cerr != nil {
+			err = errors.Join(err, fmt.Errorf("error closing JSON file: %w", cerr))
+		}
+	}
+	return err
+}
+
+// HTTPSink POSTs readings in NDJSON format to an HTTP endpoint in batches.
+// A batch is sent when it reaches the batch size and whenever the sink is flushed.
+type HTTPSink struct {
+	URL       string       // Endpoint receiving the readings.
+	BatchSize int          // Number of readings per request; defaults to 500.
+	Client    *http.Client // HTTP client used for requests; defaults to a client with a 30 second timeout.
+	Logger    *slog.Logger // Logger for diagnostics; defaults to the default logger.
+
+	batch   bytes.Buffer
+	pending int
+}
+
+// Open prepares the sink; no connection is made until the first batch is sent.
+func (s *HTTPSink) Open() error {
+	if s.BatchSize <= 0 {
+		s.BatchSize = defaultHTTPBatchSize
+	}
+	if s.Client == nil {
+		s.Client = &http.Client{Timeout: httpTimeout}
+	}
+	s.Logger = loggerOrDefault(s.Logger)
+	return nil
+}
+
+// Write adds the reading to the current batch and sends the batch once it is full.
+func (s *HTTPSink) Write(reading TemperatureReading) error {
+	if err := writeJSONLine(&s.batch, reading); err != nil {
+		return err
+	}
+	s.pending++
+	if s.pending >= s.BatchSize {
+		return s.Flush()
+	}
+	return nil
+}
+
+// Flush sends the current batch, if any, as a single request.
+func (s *HTTPSink) Flush() error {
+	if s.pending == 0 {
+		return nil
+	}
+
+	resp, err := s.Client.Post(s.URL, "application/x-ndjson", bytes.NewReader(s.batch.Bytes()))
+	if err != nil {
+		return fmt.Errorf("error sending readings: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			s.Logger.Warn("Error closing HTTP response body", "url", s.URL, "error", err)
+		}
+	}()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("error sending readings: unexpected status %s", resp.Status)
+	}
+
+	s.batch.Reset()
+	s.pending = 0
+	return nil
+}
+
+// Close sends any readings that are still buffered.
+func (s *HTTPSink) Close() error {
+	return s.Flush()
+}
+
+// MultiSink fans every operation out to several sinks, so that one run can feed multiple destinations.
+type MultiSink struct {
+	sinks []Sink
+	open  []Sink
+}
+
+// NewMultiSink returns a sink that writes every reading to all the given sinks.
+func NewMultiSink(sinks ...Sink) *MultiSink {
+	return &MultiSink{sinks: sinks}
+}
+
+// Open opens every sink. If one fails, the sinks opened so far are closed again.
+func (m *MultiSink) Open() error {
+	for _, sink := range m.sinks {
+		if err := sink.Open(); err != nil {
+			return errors.Join(err, m.Close())
+		}
+		m.open = append(m.open, sink)
+	}
+	return nil
+}
+
+// Write writes the reading to every sink, stopping at the first error.
+func (m *MultiSink) Write(reading TemperatureReading) error {
+	for _, sink := range m.open {
+		if err := sink.Write(reading); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flush flushes every sink, stopping at the first error.
+func (m *MultiSink) Flush() error {
+	for _, sink := range m.open {
+		if err := sink.Flush(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop stops every sink that waits between retries, see Stopper.
+func (m *MultiSink) Stop() {
+	for _, sink := range m.sinks {
+		if stopper, ok := sink.(Stopper); ok {
+			stopper.Stop()
+		}
+	}
+}
+
+// Close closes every open sink and returns all errors that occurred.
+func (m *MultiSink) Close() error {
+	var errs []error
+	for _, sink := range m.open {
+		errs = append(errs, sink.Close())
+	}
+	m.open = nil
+	return errors.Join(errs...)
+}
@@ -0,0 +1,127 @@
+package simulator
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// heaterPeriod is a daily period during which a heater or cooler runs.
+type heaterPeriod struct {
+	Start string  `json:"start"` // Time of day at which the period starts, e.g. "06:30".
+	End   string  `json:"end"`   // Time of day at which the period ends; before Start for periods across midnight.
+	Power float64 `json:"power"` // Degrees the heater holds the temperature above ambient; negative for cooling.
+}
+
+// thermalParams holds the parameters of the thermal model.
+type thermalParams struct {
+	Ambient      *float64       `json:"ambient,omitempty"` // Temperature of the surroundings; defaults to the starting temperature.
+	TimeConstant Duration       `json:"timeConstant"`      // Time for 63% of the way to equilibrium; defaults to one hour.
+	Power        float64        `json:"power"`             // Heater power outside the scheduled periods.
+	Schedule     []heaterPeriod `json:"schedule"`          // Daily periods with a different heater power.
+	Timezone     string         `json:"timezone"`          // IANA time zone of the schedule; defaults to UTC.
+}
+
+// thermalModel is a first-order thermal mass, such as a room or a tank, following Newton's law of
+// cooling towards the ambient temperature plus the heat of a heater or cooler. Its power is given in
+// degrees of temperature rise at equilibrium, so a heater of power 20 in ambient 15 warms the mass
+// towards 35. Readings fluctuate randomly by up to TempFluctuation around the temperature of the mass,
+// like the noise of a real sensor, without disturbing the mass itself.
+//
+// The heater power is held at its value at the start of each reading's interval, and the temperature
+// follows the exact exponential response over the interval.
+type thermalModel struct {
+	params   thermalParams
+	location *time.Location
+	periods  []dailyPeriod
+
+	started     bool
+	temperature float64 // Temperature of the mass, without the sensor noise.
+}
+
+// dailyPeriod is a heater period with its times of day parsed as offsets from midnight.
+type dailyPeriod struct {
+	start, end time.Duration
+	power      float64
+}
+
+// newThermalModel creates a thermal model from its parameters.
+func newThermalModel(params json.RawMessage) (Model, error) {
+	p := thermalParams{TimeConstant: Duration(time.Hour)}
+	if err := decodeModelParams(params, &p); err != nil {
+		return nil, err
+	}
+	if p.TimeConstant <= 0 {
+		return nil, fmt.Errorf("timeConstant must be positive, got %s", time.Duration(p.TimeConstant))
+	}
+	location, err := time.LoadLocation(p.Timezone)
+	if err != nil {
+		return nil, fmt.Errorf("invalid timezone %q: %w", p.Timezone, err)
+	}
+
+	periods := make([]dailyPeriod, len(p.Schedule))
+	for i, period := range p.Schedule {
+		start, err := parseTimeOfDay(period.Start)
+		if err != nil {
+			return nil, fmt.Errorf("schedule[%d].start: %w", i, err)
+		}
+		end, err := parseTimeOfDay(period.End)
+		if err != nil {
+			return nil, fmt.Errorf("schedule[%d].end: %w", i, err)
+		}
+		if start == end {
+			return nil, fmt.Errorf("schedule[%d]: start and end must differ, got %s", i, period.Start)
+		}
+		periods[i] = dailyPeriod{start: start, end: end, power: period.Power}
+	}
+	return &thermalModel{params: p, location: location, periods: periods}, nil
+}
+
+// parseTimeOfDay parses a time of day such as "06:30" as the time since midnight.
+func parseTimeOfDay(value string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", value)
+	if err != nil {
+		return 0, fmt.Errorf("%q is not a time of day such as \"06:30\"", value)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// Next moves the temperature of the mass over the reading's interval and adds the sensor noise.
+func (m *thermalModel) Next(state ModelState, r *rand.Rand) float64 {
+	if !m.started {
+		m.temperature = state.Temperature
+		m.started = true
+	}
+	ambient := state.Params.StartingTemp
+	if m.params.Ambient != nil {
+		ambient = *m.params.Ambient
+	}
+
+	target := ambient + m.power(state.Time.Add(-state.Interval))
+	decay := math.Exp(-state.Interval.Seconds() / time.Duration(m.params.TimeConstant).Seconds())
+	m.temperature = target + (m.temperature-target)*decay
+
+	noise := r.Float64()*2*state.Params.TempFluctuation - state.Params.TempFluctuation
+	return m.temperature + noise
+}
+
+// power returns the heater power at the given time: that of the first scheduled period containing
+// the time of day in the model's time zone, or the default power outside all periods.
+func (m *thermalModel) power(t time.Time) float64 {
+	// Use the wall clock, so that periods keep their times of day when daylight saving time changes.
+	local := t.In(m.location)
+	timeOfDay := time.Duration(local.Hour())*time.Hour + time.Duration(local.Minute())*time.Minute +
+		time.Duration(local.Second())*time.Second
+	for _, period := range m.periods {
+		inside := timeOfDay >= period.start && timeOfDay < period.end
+		if period.start > period.end { // The period runs across midnight.
+			inside = timeOfDay >= period.start || timeOfDay < period.end
+		}
+		if inside {
+			return period.power
+		}
+	}
+	return m.params.Power
+}
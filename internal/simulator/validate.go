@@ -0,0 +1,206 @@
+package simulator
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// FieldError describes a problem with a single setting of the configuration file.
+type FieldError struct {
+	Path    string // JSON path of the setting, e.g. "sensors[2].id", or "sensorGroups[1] (n=7).id" for a grouped sensor.
+	Message string // What is wrong with the setting.
+}
+
+// Error returns the path followed by the message, e.g. `sensors[2].id: duplicate "002"`.
+func (e FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationErrors is the list of every problem found in a configuration.
+type ValidationErrors []FieldError
+
+// Error returns all problems, one per line.
+func (e ValidationErrors) Error() string {
+	lines := make([]string, len(e))
+	for i, fieldErr := range e {
+		lines[i] = fieldErr.Error()
+	}
+	return strings.Join(lines, "\n")
+}
+
+// Validate checks the configuration and sensors for settings that would make the simulation fail or
+// produce meaningless readings, such as a minimum temperature above the maximum or two sensors with
+// the same ID. It reports every problem at once rather than stopping at the first one.
+//
+// Returns nil if the configuration is valid, or ValidationErrors listing each problem with the JSON
+// path of the offending setting.
+func (sc *SensorConfig) Validate() error {
+	var errs ValidationErrors
+	addf := func(path, format string, args ...any) {
+		errs = append(errs, FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	config := sc.Config
+	if config.TotalReadings < 0 {
+		addf("config.totalReadings", "must not be negative, got %d", config.TotalReadings)
+	}
+	if config.MinTemp > config.MaxTemp {
+		addf("config.minTemp", "%g is greater than maxTemp %g", config.MinTemp, config.MaxTemp)
+	} else if config.StartingTemp < config.MinTemp || config.StartingTemp > config.MaxTemp {
+		addf("config.startingTemp", "%g is outside the range [%g, %g]", config.StartingTemp, config.MinTemp, config.MaxTemp)
+	}
+	if config.TempFluctuation < 0 {
+		addf("config.tempFluctuation", "must not be negative, got %g", config.TempFluctuation)
+	}
+	if mode, err := config.RunMode(); err != nil {
+		addf("config.mode", "must be one of backfill, realtime or accelerated, got %q", config.Mode)
+	} else if mode == ModeBackfill && config.unbounded() {
+		// A backfill run produces readings as fast as possible, so without an end it fills the disk.
+		addf("config.totalReadings", "must be positive in backfill mode unless duration or until is set")
+	}
+	if config.TimeScale < 0 {
+		addf("config.timeScale", "must be positive, got %g", config.TimeScale)
+	}
+	if config.Interval < 0 {
+		addf("config.interval", "must be positive, got %s", time.Duration(config.Interval))
+	}
+	if config.Duration < 0 {
+		addf("config.duration", "must not be negative, got %s", time.Duration(config.Duration))
+	}
+	if config.StartTime != "" {
+		if _, err := time.Parse(time.RFC3339, config.StartTime); err != nil {
+			addf("config.startTime", "%q is not an RFC 3339 timestamp", config.StartTime)
+		}
+	}
+	if config.Until != "" {
+		if _, err := time.Parse(time.RFC3339, config.Until); err != nil {
+			addf("config.until", "%q is not an RFC 3339 timestamp", config.Until)
+		}
+	}
+
+	// File sinks without a path of their own, including the default sink, write to outputFileName.
+	// The format and CSV settings of every file and stdout sink are checked, reporting a problem with
+	// a global setting once however many sinks use it.
+	sinkConfigs := config.Sinks
+	if len(sinkConfigs) == 0 {
+		sinkConfigs = []SinkConfig{{Type: "file"}}
+	}
+	needsOutputFile := false
+	reported := make(map[FieldError]bool)
+	for i, sinkConfig := range sinkConfigs {
+		sinkPath := fmt.Sprintf("config.sinks[%d]", i)
+		switch sinkConfig.Type {
+		case "file", "", "stdout":
+			path := sinkConfig.Path
+			if sinkConfig.Type == "stdout" {
+				path = "stdout"
+			} else if path == "" {
+				needsOutputFile = true
+				path = config.OutputFileName
+			}
+			for _, fieldErr := range formattedSinkErrors(sinkPath, path, sinkConfig, config) {
+				if !reported[fieldErr] {
+					reported[fieldErr] = true
+					errs = append(errs, fieldErr)
+				}
+			}
+		default:
+			if _, err := NewSink(sinkConfig, config, nil); err != nil {
+				addf(sinkPath, "%v", err)
+				continue
+			}
+			if sinkConfig.Type != "mqtt" {
+				continue
+			}
+			// Every sensor must yield a valid topic, as a broker disconnects on an invalid one.
+			topic := sinkConfig.Topic
+			if topic == "" {
+				topic = defaultMQTTTopic
+			}
+			for j, sensor := range sc.Sensors {
+				if _, err := mqttTopic(topic, sensor); err != nil {
+					addf(sc.sensorPath(j), "cannot be published by %s: %v", sinkPath, err)
+				}
+			}
+		}
+	}
+	if config.LogFilePath == "stdout" && config.WritesToStdout() {
+		addf("config.logFilePath", "must not be stdout when readings are written to stdout; use stderr or a file")
+	}
+	if needsOutputFile && config.OutputFileName == "" {
+		addf("config.outputFileName", "must not be empty when a file sink has no path")
+	}
+
+	if len(sc.Sensors) == 0 {
+		addf("sensors", "must contain at least one sensor")
+	}
+	seen := make(map[string]int, len(sc.Sensors))
+	for i, sensor := range sc.Sensors {
+		path := sc.sensorPath(i)
+		if sensor.ID == "" {
+			addf(path+".id", "must not be empty")
+		} else if first, ok := seen[sensor.ID]; ok {
+			addf(path+".id", "duplicate %q, also used by %s", sensor.ID, sc.sensorPath(first))
+		} else {
+			seen[sensor.ID] = i
+		}
+		if sensor.Interval < 0 {
+			addf(path+".interval", "must be positive, got %s", time.Duration(sensor.Interval))
+		}
+
+		// Check the temperature parameters that the sensor overrides, together with the global ones
+		// they are combined with.
+		params := sensor.Params(config)
+		overridesRange := sensor.MinTemp != nil || sensor.MaxTemp != nil
+		switch {
+		case overridesRange && params.MinTemp > params.MaxTemp:
+			addf(path+".minTemp", "%g is greater than maxTemp %g", params.MinTemp, params.MaxTemp)
+		case (overridesRange || sensor.StartingTemp != nil) && params.MinTemp <= params.MaxTemp &&
+			(params.StartingTemp < params.MinTemp || params.StartingTemp > params.MaxTemp):
+			addf(path+".startingTemp", "%g is outside the range [%g, %g]", params.StartingTemp, params.MinTemp, params.MaxTemp)
+		}
+		if sensor.TempFluctuation != nil && params.TempFluctuation < 0 {
+			addf(path+".tempFluctuation", "must not be negative, got %g", params.TempFluctuation)
+		}
+		if _, err := NewModel(sensor.Model); err != nil {
+			addf(path+".model", "%v", err)
+		}
+		for j, fault := range sensor.Faults {
+			if _, _, err := fault.validate(); err != nil {
+				addf(fmt.Sprintf("%s.faults[%d]", path, j), "%v", err)
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// formattedSinkErrors checks the output format and CSV settings of a file or stdout sink, configured
+// at sinkPath and writing to path. A problem with the sink's own format is reported against the sink,
+// and problems with the global settings it inherits against those settings.
+func formattedSinkErrors(sinkPath, path string, sinkConfig SinkConfig, config Config) []FieldError {
+	formatPath, format := sinkPath+".format", sinkConfig.Format
+	if format == "" {
+		formatPath, format = "config.outputFormat", config.OutputFormat
+	}
+	format, err := outputFormat(format, path)
+	if err != nil {
+		return []FieldError{{Path: formatPath, Message: err.Error()}}
+	}
+	if format != FormatCSV {
+		return nil
+	}
+
+	var errs []FieldError
+	if _, err := parseDelimiter(config.CSVDelimiter); err != nil {
+		errs = append(errs, FieldError{Path: "config.csvDelimiter", Message: err.Error()})
+	}
+	if _, err := csvColumnFields(config.CSVColumns); err != nil {
+		errs = append(errs, FieldError{Path: "config.csvColumns", Message: err.Error()})
+	}
+	return errs
+}
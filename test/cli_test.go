@@ -0,0 +1,46 @@
+package test
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// TestCLIDebugLogRedactsSecrets tests that the configuration logged at debug level does not reveal
+// the sink tokens, by running the command against an influx sink served by a test server.
+func TestCLIDebugLogRedactsSecrets(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping the build of the command in short mode")
+	}
+	binary := filepath.Join(t.TempDir(), "temperature-simulator-cli")
+	build := exec.Command("go", "build", "-o", binary, "../cmd/cli")
+	if output, err := build.CombinedOutput(); err != nil {
+		t.Fatalf("Error building the command: %v\n%s", err, output)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sinks := fmt.Sprintf(`[{"type": "influx", "url": %q, "org": "acme", "bucket": "sensors", "token": "SECRET-TOKEN"}]`, server.URL)
+	cmd := exec.Command(binary, "-sensor_config", "testdata/sensors.json", "-log_level", "debug", "-sinks", sinks)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	if err := cmd.Run(); err != nil {
+		t.Fatalf("Error running the command: %v\n%s", err, output.String())
+	}
+
+	if !strings.Contains(output.String(), "Loaded configuration") {
+		t.Fatalf("Expected the configuration to be logged, got\n%s", output.String())
+	}
+	if strings.Contains(output.String(), "SECRET-TOKEN") {
+		t.Errorf("Expected the token to be redacted, got\n%s", output.String())
+	}
+}
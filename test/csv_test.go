@@ -0,0 +1,124 @@
+package test
+
+import (
+	"encoding/csv"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestSaveToCSV tests that readings are written with a header row, flattened sensor fields,
+// the configured columns and the configured delimiter.
+func TestSaveToCSV(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "readings.tsv")
+	data := testReadings(3)
+	columns := []string{"time", "sensor.id", "sensor.location", "temperature"}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		if err := simulator.SaveToCSV(data, outputPath, columns, '\t', logger); err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+	if !strings.Contains(logOutput, "Data successfully saved") {
+		t.Errorf("Expected log message about successful data saving, but got: %s", logOutput)
+	}
+
+	file, err := os.Open(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.Comma = '\t'
+	records, err := reader.ReadAll()
+	if err != nil {
+		t.Fatalf("Error reading CSV output: %v", err)
+	}
+
+	if len(records) != len(data)+1 {
+		t.Fatalf("Expected %d records including the header, got %d", len(data)+1, len(records))
+	}
+	if strings.Join(records[0], ",") != strings.Join(columns, ",") {
+		t.Errorf("Unexpected header: %v", records[0])
+	}
+	expected := []string{"2023-10-01 12:00:00", "001", "LocationA", "21.00"}
+	if strings.Join(records[2], ",") != strings.Join(expected, ",") {
+		t.Errorf("Unexpected record: expected %v, got %v", expected, records[2])
+	}
+
+	// Unknown columns must be rejected before anything is written.
+	if err := simulator.SaveToCSV(data, outputPath, []string{"sensor.colour"}, 0, nil); err == nil {
+		t.Error("Expected error for unknown column, got nil")
+	}
+}
+
+// TestCSVFormatSelection tests that the output format is picked from the outputFormat setting or,
+// by default, from the file extension.
+func TestCSVFormatSelection(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name   string
+		config simulator.Config
+		header string
+	}{
+		{
+			name:   "extension",
+			config: simulator.Config{OutputFileName: filepath.Join(dir, "by-extension.csv")},
+			header: strings.Join(simulator.DefaultCSVColumns, ","),
+		},
+		{
+			name:   "explicit",
+			config: simulator.Config{OutputFileName: filepath.Join(dir, "explicit.out"), OutputFormat: "csv", CSVDelimiter: ";"},
+			header: strings.Join(simulator.DefaultCSVColumns, ";"),
+		},
+		{
+			name:   "json",
+			config: simulator.Config{OutputFileName: filepath.Join(dir, "readings.json")},
+			header: `{"time":`,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			sink, err := simulator.NewSinks(tc.config, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			if err := sink.Open(); err != nil {
+				t.Fatalf("Expected no error opening sink, got %v", err)
+			}
+			if err := sink.Write(testReadings(1)[0]); err != nil {
+				t.Fatalf("Expected no error writing, got %v", err)
+			}
+			if err := sink.Close(); err != nil {
+				t.Fatalf("Expected no error closing sink, got %v", err)
+			}
+
+			content, err := os.ReadFile(tc.config.OutputFileName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !strings.HasPrefix(string(content), tc.header) {
+				t.Errorf("Expected output starting with %q, got %q", tc.header, content)
+			}
+		})
+	}
+
+	// An unknown format, a multi-character delimiter or one the CSV writer refuses must be rejected.
+	invalid := []simulator.Config{
+		{OutputFileName: filepath.Join(dir, "readings.xml"), OutputFormat: "xml"},
+		{OutputFileName: filepath.Join(dir, "readings.csv"), CSVDelimiter: "||"},
+		{OutputFileName: filepath.Join(dir, "readings.csv"), CSVDelimiter: `"`},
+		{OutputFileName: filepath.Join(dir, "readings.csv"), CSVDelimiter: "\r"},
+		{OutputFileName: filepath.Join(dir, "readings.csv"), CSVDelimiter: "\uFFFD"},
+	}
+	for _, config := range invalid {
+		if _, err := simulator.NewSinks(config, nil); err == nil {
+			t.Errorf("Expected error for config %+v, got nil", config)
+		}
+	}
+}
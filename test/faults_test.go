@@ -0,0 +1,214 @@
+package test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestFaultWindow tests that faults without a probability affect exactly the readings within their
+// window, and that the model carries on from the clean temperature afterwards.
+func TestFaultWindow(t *testing.T) {
+	clean, _ := generateSensor(t, 10, `"faults": []`)
+	data, logs := generateSensor(t, 10, `"faults": [
+		{"type": "flatline", "start": "2024-03-01T00:02:00Z", "end": "2024-03-01T00:05:00Z"},
+		{"type": "stuck", "value": 99, "start": "2024-03-01T00:07:00Z", "end": "2024-03-01T00:09:00Z"}
+	]`)
+	if len(data) != len(clean) {
+		t.Fatalf("Expected %d readings, got %d", len(clean), len(data))
+	}
+
+	// The first reading is taken at 00:01, one interval after the start time.
+	for i, reading := range data {
+		want, fault := clean[i].Temperature, ""
+		switch {
+		case i >= 1 && i < 4:
+			want, fault = clean[1].Temperature, "flatline"
+		case i >= 6 && i < 8:
+			want, fault = 99, "stuck"
+		}
+		if reading.Temperature != want || reading.Fault != fault {
+			t.Errorf("Expected reading %d at %.2f with fault %q, got %.2f with fault %q", i, want, fault, reading.Temperature, reading.Fault)
+		}
+	}
+	if !strings.Contains(logs, "Injected faults into readings") || !strings.Contains(logs, "faulty=5") {
+		t.Errorf("Expected the number of faulty readings to be logged, got:\n%s", logs)
+	}
+}
+
+// TestFaultProbabilityZero tests that a probability of 0 turns a fault off, rather than leaving it
+// active for every reading like a fault without a probability.
+func TestFaultProbabilityZero(t *testing.T) {
+	clean, _ := generateSensor(t, 10, `"faults": []`)
+	data, _ := generateSensor(t, 10, `"faults": [{"type": "nan", "probability": 0}]`)
+	if len(data) != len(clean) {
+		t.Fatalf("Expected %d readings, got %d", len(clean), len(data))
+	}
+	for i, reading := range data {
+		if reading.Temperature != clean[i].Temperature || reading.Fault != "" {
+			t.Errorf("Expected clean reading %d at %.2f, got %.2f with fault %q", i, clean[i].Temperature, reading.Temperature, reading.Fault)
+		}
+	}
+}
+
+// TestFaultShifts tests that offset and drift faults add up, and that spikes and garbage values stay
+// within the configured magnitude.
+func TestFaultShifts(t *testing.T) {
+	clean, _ := generateSensor(t, 10, `"faults": []`)
+
+	// A drift of 60 degrees per hour adds one degree per one-minute reading.
+	data, _ := generateSensor(t, 10, `"faults": [{"type": "offset", "value": 5}, {"type": "drift", "value": 60}]`)
+	for i, reading := range data {
+		want := float64(clean[i].Temperature) + 5 + float64(i)
+		if math.Abs(float64(reading.Temperature)-want) > 1e-9 || reading.Fault != "offset,drift" {
+			t.Errorf("Expected reading %d at %.2f with fault offset,drift, got %.2f with fault %q", i, want, reading.Temperature, reading.Fault)
+		}
+	}
+
+	data, _ = generateSensor(t, 10, `"faults": [{"type": "spike", "value": 15}]`)
+	for i, reading := range data {
+		if diff := math.Abs(float64(reading.Temperature - clean[i].Temperature)); math.Abs(diff-15) > 1e-9 {
+			t.Errorf("Expected reading %d to spike by 15, got %.2f instead of %.2f", i, reading.Temperature, clean[i].Temperature)
+		}
+	}
+
+	data, _ = generateSensor(t, 50, `"faults": [{"type": "garbage", "value": 500}]`)
+	distinct := map[simulator.Temperature]bool{}
+	for i, reading := range data {
+		if math.Abs(float64(reading.Temperature)) > 500 || reading.Fault != "garbage" {
+			t.Errorf("Expected reading %d to be garbage of at most 500, got %.2f with fault %q", i, reading.Temperature, reading.Fault)
+		}
+		distinct[reading.Temperature] = true
+	}
+	if len(distinct) < 10 {
+		t.Errorf("Expected random garbage values, got %d distinct values", len(distinct))
+	}
+}
+
+// TestFaultNaN tests that readings that are not a number are written as null in JSON and without
+// their temperature field in line protocol.
+func TestFaultNaN(t *testing.T) {
+	data, _ := generateSensor(t, 1, `"faults": [{"type": "nan"}]`)
+	if len(data) != 1 || !math.IsNaN(float64(data[0].Temperature)) || data[0].Fault != "nan" {
+		t.Fatalf("Expected a single reading that is not a number, got %+v", data)
+	}
+
+	encoded, err := json.Marshal(data[0])
+	if err != nil {
+		t.Fatalf("Error encoding reading: %v", err)
+	}
+	if !strings.Contains(string(encoded), `"temperature":null`) || !strings.Contains(string(encoded), `"fault":"nan"`) {
+		t.Errorf("Expected null temperature with fault, got %s", encoded)
+	}
+	var decoded simulator.TemperatureReading
+	if err := json.Unmarshal(encoded, &decoded); err != nil || !math.IsNaN(float64(decoded.Temperature)) {
+		t.Errorf("Expected null to decode as not a number, got %v (%v)", decoded.Temperature, err)
+	}
+
+	line, err := simulator.AppendLineProtocol(nil, "", data[0])
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	expected := "temperature,fault=nan,id=001,name=SensorA seed=1i 1709251260000000000\n"
+	if string(line) != expected {
+		t.Errorf("Unexpected line protocol.\nExpected: %q\nGot: %q", expected, line)
+	}
+}
+
+// TestFaultDropout tests that dropped readings are left out, that faults started by chance last for
+// their duration, and that the same seed drops the same readings.
+func TestFaultDropout(t *testing.T) {
+	data, logs := generateSensor(t, 200, `"faults": [{"type": "dropout", "probability": 0.05, "duration": "3m"}]`)
+	if len(data) == 0 || len(data) >= 200 {
+		t.Fatalf("Expected some readings to be dropped, got %d of 200", len(data))
+	}
+	if !strings.Contains(logs, fmt.Sprintf("dropped=%d", 200-len(data))) {
+		t.Errorf("Expected the number of dropped readings to be logged, got:\n%s", logs)
+	}
+
+	// Each dropout lasts three minutes, so gaps between readings span at least four minutes.
+	for i := 1; i < len(data); i++ {
+		previous, _ := data[i-1].Timestamp()
+		current, _ := data[i].Timestamp()
+		if gap := current.Sub(previous).Minutes(); gap != 1 && gap < 4 {
+			t.Errorf("Expected a gap of at least four minutes before %s, got %.0f", data[i].Time, gap)
+		}
+		if data[i].Fault != "" {
+			t.Errorf("Expected reported readings to be clean, got fault %q", data[i].Fault)
+		}
+	}
+
+	again, _ := generateSensor(t, 200, `"faults": [{"type": "dropout", "probability": 0.05, "duration": "3m"}]`)
+	if len(again) != len(data) {
+		t.Errorf("Expected the same seed to drop the same readings, got %d and %d readings", len(data), len(again))
+	}
+}
+
+// TestFaultReproducibility tests that faults do not change the clean temperatures of a seeded run,
+// so that untagged readings are identical with and without faults.
+func TestFaultReproducibility(t *testing.T) {
+	clean, _ := generateSensor(t, 200, `"tempFluctuation": 2, "faults": []`)
+	data, _ := generateSensor(t, 200, `"tempFluctuation": 2, "faults": [
+		{"type": "spike", "probability": 0.2, "value": 10},
+		{"type": "garbage", "probability": 0.1},
+		{"type": "dropout", "probability": 0.05, "duration": "2m"}
+	]`)
+
+	cleanByTime := make(map[string]simulator.Temperature, len(clean))
+	for _, reading := range clean {
+		cleanByTime[reading.Time] = reading.Temperature
+	}
+	untagged := 0
+	for _, reading := range data {
+		if reading.Fault != "" {
+			continue
+		}
+		untagged++
+		if want := cleanByTime[reading.Time]; reading.Temperature != want {
+			t.Errorf("Expected untagged reading at %s to be %.2f as without faults, got %.2f", reading.Time, want, reading.Temperature)
+		}
+	}
+	if untagged == 0 || untagged == len(clean) {
+		t.Errorf("Expected some but not all readings to be faulty, got %d untagged of %d", untagged, len(clean))
+	}
+}
+
+// TestValidateFaults tests that invalid faults are reported against the sensor and fault.
+func TestValidateFaults(t *testing.T) {
+	probability := 1.5
+	faults := []simulator.FaultSpec{
+		{Type: "glitch"},
+		{Type: simulator.FaultSpike, Probability: &probability},
+		{Type: simulator.FaultDrift, Start: "2024-03-01T12:00:00Z", End: "2024-03-01T06:00:00Z"},
+		{Type: simulator.FaultOffset, Start: "noon"},
+	}
+	sensorConfig := simulator.SensorConfig{
+		Config:  simulator.Config{OutputFileName: "out.json"},
+		Sensors: []simulator.Sensor{{ID: "001", Faults: faults}},
+	}
+
+	err := sensorConfig.Validate()
+	var validationErrs simulator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	expected := []string{
+		`sensors[0].faults[0]: unknown fault type "glitch", must be one of stuck, flatline, spike, offset, drift, dropout, nan or garbage`,
+		"sensors[0].faults[1]: probability must be between 0 and 1, got 1.5",
+		"sensors[0].faults[2]: end 2024-03-01T06:00:00Z must be after start 2024-03-01T12:00:00Z",
+		`sensors[0].faults[3]: start "noon" is not an RFC 3339 timestamp`,
+	}
+	if len(validationErrs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d:\n%v", len(expected), len(validationErrs), err)
+	}
+	for i, fieldErr := range validationErrs {
+		if fieldErr.Error() != expected[i] {
+			t.Errorf("Expected problem %q, got %q", expected[i], fieldErr.Error())
+		}
+	}
+}
@@ -0,0 +1,139 @@
+package test
+
+import (
+	"errors"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestLoadSensorGroups tests that sensor groups are expanded into individual sensors after the ones
+// listed in the sensors array, with numbered names, IDs and locations.
+func TestLoadSensorGroups(t *testing.T) {
+	configJSON := `{
+		"config": {"totalReadings": 1, "startingTemp": 20.0, "minTemp": 0.0, "maxTemp": 40.0, "outputFileName": "out.json"},
+		"sensors": [{"name": "Lobby", "id": "lobby"}],
+		"sensorGroups": [
+			{
+				"count": 500,
+				"template": {"name": "Rack {n}", "id": "rack-{n:03}", "version": "v2", "location": "Row {n:2}", "maxTemp": 35.0}
+			},
+			{"count": 2, "start": 0, "template": {"name": "Spare", "id": "spare-{n}"}}
+		]
+	}`
+	configPath := filepath.Join(t.TempDir(), "fleet.json")
+	if err := os.WriteFile(configPath, []byte(configJSON), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var sensorConfig *simulator.SensorConfig
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		var err error
+		sensorConfig, err = simulator.LoadConfigAndSensors(configPath, logger, simulator.LoadOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+	if !strings.Contains(logOutput, `msg="Loaded sensors from configuration" count=503`) {
+		t.Errorf("Expected the expanded sensors to be counted, but got: %s", logOutput)
+	}
+
+	sensors := sensorConfig.Sensors
+	if len(sensors) != 503 || len(sensorConfig.SensorGroups) != 0 {
+		t.Fatalf("Expected 503 sensors and no groups left, got %d sensors and %d groups", len(sensors), len(sensorConfig.SensorGroups))
+	}
+	if sensors[0].ID != "lobby" {
+		t.Errorf("Expected the listed sensor first, got %+v", sensors[0])
+	}
+	first, last := sensors[1], sensors[500]
+	if first.Name != "Rack 1" || first.ID != "rack-001" || first.Location != "Row  1" || first.Version != "v2" {
+		t.Errorf("Unexpected first rack %+v", first)
+	}
+	if last.Name != "Rack 500" || last.ID != "rack-500" || last.Location != "Row 500" {
+		t.Errorf("Unexpected last rack %+v", last)
+	}
+	if last.MaxTemp == nil || *last.MaxTemp != 35.0 {
+		t.Errorf("Expected the rack to keep the template's maxTemp override, got %v", last.MaxTemp)
+	}
+	if sensors[501].ID != "spare-0" || sensors[502].ID != "spare-1" {
+		t.Errorf("Expected spares numbered from 0, got %s and %s", sensors[501].ID, sensors[502].ID)
+	}
+	if err := sensorConfig.Validate(); err != nil {
+		t.Errorf("Expected a valid configuration, got:\n%v", err)
+	}
+}
+
+// TestExpandSensorGroupsInvalid tests that groups without sensors or with too many are rejected, that
+// IDs repeated by a group are reported against the group, and that validation names the group and
+// number of the sensors expanded from a group and the index of the sensors listed individually.
+func TestExpandSensorGroupsInvalid(t *testing.T) {
+	sensorConfig := simulator.SensorConfig{
+		SensorGroups: []simulator.SensorGroup{
+			{Count: 2, Template: simulator.Sensor{ID: "rack"}},
+			{Count: 0, Template: simulator.Sensor{ID: "spare-{n}"}},
+		},
+	}
+	err := sensorConfig.ExpandSensorGroups()
+	var fieldErr simulator.FieldError
+	if !errors.As(err, &fieldErr) || fieldErr.Error() != "sensorGroups[1].count: must be between 1 and 100000, got 0" {
+		t.Errorf("Expected error about the count, got %v", err)
+	}
+
+	// A huge count is rejected before any sensor is expanded.
+	sensorConfig = simulator.SensorConfig{
+		SensorGroups: []simulator.SensorGroup{
+			{Count: 2, Template: simulator.Sensor{ID: "rack-{n}"}},
+			{Count: 2000000000, Template: simulator.Sensor{ID: "spare-{n}"}},
+		},
+	}
+	err = sensorConfig.ExpandSensorGroups()
+	if !errors.As(err, &fieldErr) || fieldErr.Path != "sensorGroups[1].count" || len(sensorConfig.Sensors) != 0 {
+		t.Errorf("Expected error about the count before expanding, got %v and %d sensors", err, len(sensorConfig.Sensors))
+	}
+
+	// IDs repeated within a group, or clashing with a listed sensor, are reported against the group.
+	duplicates := []struct {
+		sensors  []simulator.Sensor
+		groups   []simulator.SensorGroup
+		expected string
+	}{
+		{
+			nil,
+			[]simulator.SensorGroup{{Count: 2, Template: simulator.Sensor{ID: "rack"}}},
+			`sensorGroups[0] (n=2).id: duplicate "rack", also used by sensorGroups[0] (n=1)`,
+		},
+		{
+			[]simulator.Sensor{{ID: "lobby"}, {ID: "rack-07"}},
+			[]simulator.SensorGroup{{Count: 10, Template: simulator.Sensor{ID: "rack-{n:02}"}}},
+			`sensorGroups[0] (n=7).id: duplicate "rack-07", also used by sensors[1]`,
+		},
+	}
+	for _, tc := range duplicates {
+		sensorConfig = simulator.SensorConfig{Sensors: tc.sensors, SensorGroups: tc.groups}
+		err = sensorConfig.ExpandSensorGroups()
+		if err == nil || err.Error() != tc.expected {
+			t.Errorf("Expected error %q, got %v", tc.expected, err)
+		}
+	}
+
+	sensorConfig = simulator.SensorConfig{
+		Config:       simulator.Config{OutputFileName: "out.json"},
+		Sensors:      []simulator.Sensor{{ID: ""}},
+		SensorGroups: []simulator.SensorGroup{{Count: 2, Template: simulator.Sensor{ID: "rack-{n}", Interval: simulator.Duration(-time.Minute)}}},
+	}
+	if err := sensorConfig.ExpandSensorGroups(); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	err = sensorConfig.Validate()
+	expected := "sensors[0].id: must not be empty\n" +
+		"sensorGroups[0] (n=1).interval: must be positive, got -1m0s\n" +
+		"sensorGroups[0] (n=2).interval: must be positive, got -1m0s"
+	if err == nil || err.Error() != expected {
+		t.Errorf("Expected problems:\n%s\ngot:\n%v", expected, err)
+	}
+}
@@ -0,0 +1,209 @@
+package test
+
+import (
+	"compress/gzip"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestAppendLineProtocol tests the encoding of a reading as line protocol, including escaping of
+// special characters, omission of empty tags and nanosecond timestamps.
+func TestAppendLineProtocol(t *testing.T) {
+	reading := simulator.TemperatureReading{
+		Time:        "2024-03-01 12:00:00.250",
+		Temperature: simulator.Temperature(21.5),
+		Sensor:      simulator.Sensor{Name: "Sensor A", ID: "001", Location: "rack=1,row 2"},
+		Seed:        42,
+	}
+
+	line, err := simulator.AppendLineProtocol(nil, "server room", reading)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	// 2024-03-01 12:00:00.250 UTC in nanoseconds since the epoch.
+	expected := `server\ room,id=001,location=rack\=1\,row\ 2,name=Sensor\ A temperature=21.50,seed=42i 1709294400250000000` + "\n"
+	if string(line) != expected {
+		t.Errorf("Unexpected line protocol.\nExpected: %q\nGot: %q", expected, line)
+	}
+
+	// A reading with an unparseable time must be rejected.
+	reading.Time = "yesterday"
+	if _, err := simulator.AppendLineProtocol(nil, "", reading); err == nil {
+		t.Error("Expected error for invalid time, got nil")
+	}
+}
+
+// TestInfluxSink tests that readings are written to the write endpoint in gzip-compressed batches,
+// with the expected parameters and token, and that transient failures are retried.
+func TestInfluxSink(t *testing.T) {
+	var mu sync.Mutex
+	var lines []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+
+		// Fail the very first request to exercise the retry.
+		if requests == 1 {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+			return
+		}
+
+		if r.URL.Path != "/api/v2/write" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		query := r.URL.Query()
+		if query.Get("org") != "acme" || query.Get("bucket") != "sensors" || query.Get("precision") != "ns" {
+			t.Errorf("Unexpected query %s", r.URL.RawQuery)
+		}
+		if auth := r.Header.Get("Authorization"); auth != "Token secret" {
+			t.Errorf("Unexpected authorization header %q", auth)
+		}
+		if encoding := r.Header.Get("Content-Encoding"); encoding != "gzip" {
+			t.Errorf("Expected gzip content encoding, got %q", encoding)
+		}
+
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			t.Errorf("Error reading gzip body: %v", err)
+			return
+		}
+		body, err := io.ReadAll(gz)
+		if err != nil {
+			t.Errorf("Error reading gzip body: %v", err)
+			return
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(body)), "\n")...)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	sink := &simulator.InfluxSink{
+		URL:          server.URL,
+		Org:          "acme",
+		Bucket:       "sensors",
+		Token:        "secret",
+		BatchSize:    2,
+		RetryBackoff: time.Millisecond,
+		Gzip:         true,
+	}
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		sink.Logger = logger
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		for _, reading := range testReadings(5) {
+			if err := sink.Write(reading); err != nil {
+				t.Fatalf("Expected no error writing, got %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error closing sink, got %v", err)
+		}
+	})
+
+	if len(lines) != 5 {
+		t.Fatalf("Expected 5 lines, got %d: %v", len(lines), lines)
+	}
+	if !strings.HasPrefix(lines[0], "temperature,id=001,location=LocationA,name=SensorA,version=v1.0 temperature=20.00,seed=1i ") {
+		t.Errorf("Unexpected line: %s", lines[0])
+	}
+	// One failed attempt plus three batches of at most two readings.
+	if requests != 4 {
+		t.Errorf("Expected 4 requests, got %d", requests)
+	}
+	if !strings.Contains(logOutput, `level=WARN msg="Retrying write after error"`) {
+		t.Errorf("Expected log message about retrying, but got: %s", logOutput)
+	}
+}
+
+// TestInfluxSinkClientError tests that client errors are reported without retrying.
+func TestInfluxSinkClientError(t *testing.T) {
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+	}))
+	defer server.Close()
+
+	sink := &simulator.InfluxSink{URL: server.URL, Bucket: "sensors", BatchSize: 1, RetryBackoff: time.Millisecond}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sink, got %v", err)
+	}
+	captureLogs(func(logger *slog.Logger) {
+		if err := sink.Write(testReadings(1)[0]); err == nil {
+			t.Error("Expected error for unauthorized write, got nil")
+		}
+	})
+	if requests != 1 {
+		t.Errorf("Expected a single request, got %d", requests)
+	}
+}
+
+// TestInfluxSinkRetries tests that a maximum of zero retries disables retrying, and that stopping the
+// sink ends a wait between retries at once.
+func TestInfluxSinkRetries(t *testing.T) {
+	var mu sync.Mutex
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requests++
+		mu.Unlock()
+		http.Error(w, "overloaded", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	noRetries := 0
+	sink := &simulator.InfluxSink{URL: server.URL, Bucket: "sensors", BatchSize: 1, MaxRetries: &noRetries, RetryBackoff: time.Millisecond}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sink, got %v", err)
+	}
+	captureLogs(func(logger *slog.Logger) {
+		if err := sink.Write(testReadings(1)[0]); err == nil {
+			t.Error("Expected error for failed write, got nil")
+		}
+	})
+	if requests != 1 {
+		t.Errorf("Expected a single request without retries, got %d", requests)
+	}
+
+	// With the default retries and a long backoff, the write only fails early if stopping works.
+	sink = &simulator.InfluxSink{URL: server.URL, Bucket: "sensors", BatchSize: 1, RetryBackoff: time.Hour}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sink, got %v", err)
+	}
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		sink.Logger = logger
+		time.AfterFunc(50*time.Millisecond, sink.Stop)
+		done := make(chan error, 1)
+		go func() { done <- sink.Write(testReadings(1)[0]) }()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("Expected error for stopped write, got nil")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected stopping the sink to end the wait between retries")
+		}
+	})
+	if !strings.Contains(logOutput, `msg="Stopped retrying write"`) {
+		t.Errorf("Expected log message about stopping, but got: %s", logOutput)
+	}
+
+	// A negative maximum is rejected.
+	negative := -1
+	sink = &simulator.InfluxSink{URL: server.URL, Bucket: "sensors", MaxRetries: &negative}
+	if err := sink.Open(); err == nil {
+		t.Error("Expected error for negative max retries, got nil")
+	}
+}
@@ -0,0 +1,70 @@
+package test
+
+import (
+	"log/slog"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestMetrics tests that the exporter serves one gauge per sensor with the sensor metadata as
+// labels, along with counters of produced, clamped and faulty readings.
+func TestMetrics(t *testing.T) {
+	metrics := simulator.NewMetrics(nil)
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{
+			{Name: "SensorA", ID: "001", Version: "v1.0", Location: "Rack \"A\""},
+			{Name: "SensorB", ID: "002", Version: "v1.1", Location: "LocationB"},
+		},
+		Config: simulator.Config{
+			TotalReadings:   10,
+			StartingTemp:    49.0,
+			MinTemp:         -10.0,
+			MaxTemp:         50.0,
+			MaxTempIncrease: 30.0,
+			Mode:            simulator.ModeBackfill,
+			Seed:            3,
+		},
+	}
+
+	captureLogs(func(logger *slog.Logger) {
+		data, err := generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for _, reading := range data {
+			if err := metrics.Write(reading); err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		}
+	})
+
+	recorder := httptest.NewRecorder()
+	metrics.ServeHTTP(recorder, httptest.NewRequest("GET", "/metrics", nil))
+	body := recorder.Body.String()
+
+	expected := []string{
+		"# TYPE temperature_simulator_sensor_temperature gauge",
+		`temperature_simulator_sensor_temperature{name="SensorA",id="001",version="v1.0",location="Rack \"A\""} 50`,
+		`temperature_simulator_sensor_temperature{name="SensorB",id="002",version="v1.1",location="LocationB"} 50`,
+		"# TYPE temperature_simulator_readings_total counter",
+		`temperature_simulator_readings_total{name="SensorA",id="001",version="v1.0",location="Rack \"A\""} 10`,
+		"# TYPE temperature_simulator_clamped_readings_total counter",
+		"# TYPE temperature_simulator_faulty_readings_total counter",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line+"\n") {
+			t.Errorf("Expected metrics to contain %q, got:\n%s", line, body)
+		}
+	}
+
+	// The ramp pushes both sensors past the maximum, so clamps must have been counted.
+	if strings.Contains(body, `temperature_simulator_clamped_readings_total{name="SensorA",id="001",version="v1.0",location="Rack \"A\""} 0`) {
+		t.Errorf("Expected clamped readings to be counted, got:\n%s", body)
+	}
+	if ct := recorder.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+		t.Errorf("Unexpected content type %q", ct)
+	}
+}
@@ -0,0 +1,266 @@
+package test
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// constantModel is a test model that always returns the same temperature.
+type constantModel struct {
+	Value float64 `json:"value"`
+}
+
+// Next returns the configured value.
+func (m *constantModel) Next(state simulator.ModelState, r *rand.Rand) float64 {
+	return m.Value
+}
+
+func init() {
+	simulator.RegisterModel("constant", func(params json.RawMessage) (simulator.Model, error) {
+		model := &constantModel{}
+		if err := json.Unmarshal(params, model); err != nil {
+			return nil, err
+		}
+		return model, nil
+	})
+}
+
+// TestNewModel tests that sensors without a model use the sawtooth model, and that unknown models
+// and invalid parameters are rejected.
+func TestNewModel(t *testing.T) {
+	if _, err := simulator.NewModel(nil); err != nil {
+		t.Errorf("Expected the default model, got %v", err)
+	}
+	if names := strings.Join(simulator.ModelNames(), ","); !strings.Contains(names, "constant") || !strings.Contains(names, "sawtooth") {
+		t.Errorf("Expected the registered models, got %s", names)
+	}
+
+	tests := []struct {
+		spec     simulator.ModelSpec
+		expected string
+	}{
+		{simulator.ModelSpec{Name: "linear"}, `unknown model "linear", must be one of `},
+		{simulator.ModelSpec{Name: "sawtooth", Params: json.RawMessage(`{"cycel": "1h"}`)}, `unknown field "cycel"`},
+		{simulator.ModelSpec{Name: "sawtooth", Params: json.RawMessage(`{"cycle": "5m", "increasePeriod": "10m"}`)}, "increasePeriod must be positive and at most the cycle"},
+	}
+	for _, tc := range tests {
+		_, err := simulator.NewModel(&tc.spec)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+
+	// Validation reports the model of the offending sensor.
+	sensorConfig := simulator.SensorConfig{
+		Config:  simulator.Config{OutputFileName: "out.json"},
+		Sensors: []simulator.Sensor{{ID: "001", Model: &tests[0].spec}},
+	}
+	err := sensorConfig.Validate()
+	if err == nil || !strings.HasPrefix(err.Error(), `sensors[0].model: unknown model "linear"`) {
+		t.Errorf("Expected model problem, got %v", err)
+	}
+}
+
+// TestSawtoothModel tests that the sawtooth model applies the increase during the configured part
+// of each cycle.
+func TestSawtoothModel(t *testing.T) {
+	data, _ := generateSensor(t, 20, `"model": {"name": "sawtooth", "params": {"cycle": "10m", "increasePeriod": "2m"}}`)
+
+	// Readings one and two, and eleven and twelve, fall within an increase period.
+	expected := []float64{25, 30, 30, 30, 30, 30, 30, 30, 30, 30, 35, 40}
+	for i, want := range expected {
+		if got := float64(data[i].Temperature); got != want {
+			t.Errorf("Expected reading %d at %.2f, got %.2f", i, want, got)
+		}
+	}
+}
+
+// TestRegisterModel tests that a registered model can be selected by name, with its parameters, and
+// that registering a name twice panics.
+func TestRegisterModel(t *testing.T) {
+	data, _ := generateSensor(t, 3, `"model": {"name": "constant", "params": {"value": 42.5}}`)
+	for _, reading := range data {
+		if reading.Temperature != 42.5 {
+			t.Errorf("Expected the constant model's temperature, got %.2f", reading.Temperature)
+		}
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected registering a model twice to panic")
+		}
+	}()
+	simulator.RegisterModel("sawtooth", func(json.RawMessage) (simulator.Model, error) { return nil, nil })
+}
+
+// TestModelSeedPerSensor tests that the temperatures of a sensor in a seeded run do not depend on
+// the sensors added after it.
+func TestModelSeedPerSensor(t *testing.T) {
+	// generate runs a seeded simulation of the given sensors and returns the temperatures by sensor ID.
+	generate := func(sensors ...simulator.Sensor) map[string][]simulator.Temperature {
+		generator := &simulator.Generator{
+			Sensors: sensors,
+			Config: simulator.Config{
+				TotalReadings:   30,
+				StartingTemp:    20.0,
+				TempFluctuation: 3.0,
+				MinTemp:         -100.0,
+				MaxTemp:         100.0,
+				Mode:            simulator.ModeBackfill,
+				Seed:            7,
+			},
+		}
+		temps := make(map[string][]simulator.Temperature)
+		captureLogs(func(logger *slog.Logger) {
+			generator.Logger = logger
+			data, err := generator.Generate()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+			for _, reading := range data {
+				temps[reading.Sensor.ID] = append(temps[reading.Sensor.ID], reading.Temperature)
+			}
+		})
+		return temps
+	}
+
+	a, b, c := simulator.Sensor{ID: "001"}, simulator.Sensor{ID: "002"}, simulator.Sensor{ID: "003"}
+	pair, trio := generate(a, b), generate(a, b, c)
+	for _, id := range []string{"001", "002"} {
+		if !reflect.DeepEqual(pair[id], trio[id]) {
+			t.Errorf("Expected sensor %s to keep its temperatures when a sensor is added, got %v and %v", id, pair[id], trio[id])
+		}
+	}
+	if reflect.DeepEqual(pair["001"], pair["002"]) {
+		t.Error("Expected sensors to draw different temperatures")
+	}
+}
+
+// TestCyclicModel tests that the cyclic model peaks at the configured hour in the configured time
+// zone, and follows the seasonal curve.
+func TestCyclicModel(t *testing.T) {
+	// Reading k is taken k+1 minutes after midnight UTC on 1 March 2024.
+	at := func(data []simulator.TemperatureReading, hour, minute int) float64 {
+		t.Helper()
+		reading := data[hour*60+minute-1]
+		if want := fmt.Sprintf("2024-03-01 %02d:%02d:00", hour, minute); reading.Time != want {
+			t.Fatalf("Expected reading at %s, got %s", want, reading.Time)
+		}
+		return float64(reading.Temperature)
+	}
+	near := func(got, want float64) bool { return got > want-0.01 && got < want+0.01 }
+
+	data, _ := generateSensor(t, 24*60-1, `"model": {"name": "cyclic", "params": {"mean": 10, "dailyAmplitude": 5, "peakHour": 15}}`)
+	if got := at(data, 15, 0); !near(got, 15) {
+		t.Errorf("Expected the daily maximum of 15 at 15:00, got %.2f", got)
+	}
+	if got := at(data, 3, 0); !near(got, 5) {
+		t.Errorf("Expected the daily minimum of 5 at 03:00, got %.2f", got)
+	}
+	if got := at(data, 9, 0); !near(got, 10) {
+		t.Errorf("Expected the mean of 10 at 09:00, got %.2f", got)
+	}
+
+	// 15:00 in New York is 20:00 UTC in March, before daylight saving time starts.
+	data, _ = generateSensor(t, 24*60-1, `"model": {"name": "cyclic", "params": {"dailyAmplitude": 5, "timezone": "America/New_York"}}`)
+	if got := at(data, 20, 0); !near(got, 25) {
+		t.Errorf("Expected the daily maximum of 25 at 20:00 UTC, got %.2f", got)
+	}
+
+	// 1 March is day 61 of 2024, so a seasonal peak on that day is reached at once.
+	data, _ = generateSensor(t, 1, `"model": {"name": "cyclic", "params": {"seasonalAmplitude": 8, "peakDay": 61}}`)
+	if got := at(data, 0, 1); !near(got, 28) {
+		t.Errorf("Expected the seasonal maximum of 28, got %.2f", got)
+	}
+
+	_, err := simulator.NewModel(&simulator.ModelSpec{Name: "cyclic", Params: json.RawMessage(`{"timezone": "Mars/Olympus_Mons"}`)})
+	if err == nil || !strings.Contains(err.Error(), `invalid timezone "Mars/Olympus_Mons"`) {
+		t.Errorf("Expected timezone error, got %v", err)
+	}
+}
+
+// TestMeanRevertingModel tests that the mean-reverting model decays towards its setpoint, and that a
+// long run settles around the setpoint with the variance of an Ornstein-Uhlenbeck process instead
+// of drifting to the temperature limits.
+func TestMeanRevertingModel(t *testing.T) {
+	// Without noise, the distance to the setpoint shrinks by a factor of e every hour at rate 1.
+	data, _ := generateSensor(t, 60, `"model": {"name": "meanReverting", "params": {"setpoint": 50, "reversionRate": 1, "volatility": 0}}`)
+	if got, want := float64(data[59].Temperature), 50-30/math.E; math.Abs(got-want) > 0.01 {
+		t.Errorf("Expected %.2f after an hour, got %.2f", want, got)
+	}
+
+	// The long-run variance is volatility² / (2 × reversionRate) = 16 / 4 = 4.
+	data, _ = generateSensor(t, 100000, `"model": {"name": "meanReverting", "params": {"reversionRate": 2, "volatility": 4}}`)
+	var sum, sumSquares float64
+	for _, reading := range data {
+		if reading.Clamped {
+			t.Fatalf("Expected no clamped readings, got %+v", reading)
+		}
+		sum += float64(reading.Temperature)
+	}
+	mean := sum / float64(len(data))
+	for _, reading := range data {
+		sumSquares += (float64(reading.Temperature) - mean) * (float64(reading.Temperature) - mean)
+	}
+	variance := sumSquares / float64(len(data)-1)
+	if math.Abs(mean-20) > 0.3 {
+		t.Errorf("Expected a long-run mean near the setpoint of 20, got %.3f", mean)
+	}
+	if math.Abs(variance-4) > 0.8 {
+		t.Errorf("Expected a long-run variance near 4, got %.3f", variance)
+	}
+
+	_, err := simulator.NewModel(&simulator.ModelSpec{Name: "meanReverting", Params: json.RawMessage(`{"reversionRate": 0}`)})
+	if err == nil || !strings.Contains(err.Error(), "reversionRate must be positive") {
+		t.Errorf("Expected reversion rate error, got %v", err)
+	}
+}
+
+// TestThermalModel tests that the thermal model cools towards the ambient temperature with its time
+// constant, and warms and cools as its heater schedule switches.
+func TestThermalModel(t *testing.T) {
+	// Without a heater, the distance to ambient shrinks by a factor of e per time constant.
+	data, _ := generateSensor(t, 60, `"model": {"name": "thermal", "params": {"ambient": 10, "timeConstant": "1h"}}`)
+	if got, want := float64(data[59].Temperature), 10+10/math.E; math.Abs(got-want) > 0.01 {
+		t.Errorf("Expected %.2f after one time constant, got %.2f", want, got)
+	}
+	for i := 1; i < len(data); i++ {
+		if data[i].Temperature >= data[i-1].Temperature {
+			t.Fatalf("Expected the temperature to fall steadily, got %.2f after %.2f", data[i].Temperature, data[i-1].Temperature)
+		}
+	}
+
+	// A heater warms the mass by its power above ambient from 06:00 to 18:00, and a cooler takes it
+	// below ambient from 22:00 to 02:00.
+	data, _ = generateSensor(t, 26*60, `"model": {"name": "thermal", "params": {"ambient": 10, "timeConstant": "30m",
+		"schedule": [{"start": "06:00", "end": "18:00", "power": 30}, {"start": "22:00", "end": "02:00", "power": -5}]}}`)
+	checks := []struct {
+		time string
+		want float64
+	}{
+		{"2024-03-01 06:00:00", 10},
+		{"2024-03-01 18:00:00", 40},
+		{"2024-03-01 22:00:00", 10},
+		{"2024-03-02 02:00:00", 5},
+	}
+	for _, check := range checks {
+		for _, reading := range data {
+			if reading.Time == check.time && math.Abs(float64(reading.Temperature)-check.want) > 0.05 {
+				t.Errorf("Expected about %.2f at %s, got %.2f", check.want, check.time, reading.Temperature)
+			}
+		}
+	}
+
+	_, err := simulator.NewModel(&simulator.ModelSpec{Name: "thermal", Params: json.RawMessage(`{"schedule": [{"start": "6am", "end": "18:00"}]}`)})
+	if err == nil || !strings.Contains(err.Error(), `schedule[0].start: "6am" is not a time of day`) {
+		t.Errorf("Expected schedule error, got %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package test
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// mqttMessage is a message accepted by the test broker.
+type mqttMessage struct {
+	topic   string
+	payload []byte
+	qos     byte
+	retain  bool
+	dup     bool
+}
+
+// testBroker is a minimal in-process MQTT broker that accepts connections, acknowledges
+// publications at every QoS level and records the messages it receives.
+type testBroker struct {
+	listener net.Listener
+
+	// dropPublish, when positive, makes the broker close the first connection upon receiving that
+	// many publications, without acknowledging the last one.
+	dropPublish int
+
+	// silentPings makes the broker leave the pings of the first connection unanswered, as if the
+	// connection had broken without being closed.
+	silentPings bool
+
+	mu          sync.Mutex
+	messages    []mqttMessage
+	versions    []byte
+	clientIDs   []string
+	connections int
+}
+
+// newTestBroker starts a test broker on a random local port.
+func newTestBroker(t *testing.T) *testBroker {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Error starting test broker: %v", err)
+	}
+	broker := &testBroker{listener: listener}
+	go broker.serve()
+	t.Cleanup(func() { listener.Close() })
+	return broker
+}
+
+// url returns the broker URL of the test broker.
+func (b *testBroker) url() string {
+	return "tcp://" + b.listener.Addr().String()
+}
+
+// snapshot returns a copy of the recorded messages.
+func (b *testBroker) snapshot() []mqttMessage {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]mqttMessage(nil), b.messages...)
+}
+
+// serve accepts connections until the listener is closed.
+func (b *testBroker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.mu.Lock()
+		b.connections++
+		first := b.connections == 1
+		b.mu.Unlock()
+		go b.handle(conn, first)
+	}
+}
+
+// handle speaks the broker side of the protocol on one connection.
+func (b *testBroker) handle(conn net.Conn, first bool) {
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	var version byte
+	published := 0
+
+	for {
+		header, body, err := readTestPacket(reader)
+		if err != nil {
+			return
+		}
+
+		switch header & 0xF0 {
+		case 0x10: // CONNECT: protocol name, level, flags, keep-alive, [properties], client ID.
+			version = body[6]
+			rest := body[10:]
+			if version == simulator.MQTTv5 {
+				rest = rest[1:]
+			}
+			clientIDLength := int(rest[0])<<8 | int(rest[1])
+			clientID := string(rest[2 : 2+clientIDLength])
+			b.mu.Lock()
+			b.versions = append(b.versions, version)
+			b.clientIDs = append(b.clientIDs, clientID)
+			b.mu.Unlock()
+			if version == simulator.MQTTv5 {
+				conn.Write([]byte{0x20, 3, 0, 0, 0})
+			} else {
+				conn.Write([]byte{0x20, 2, 0, 0})
+			}
+
+		case 0x30: // PUBLISH
+			published++
+			if first && b.dropPublish > 0 && published == b.dropPublish {
+				return
+			}
+
+			message := mqttMessage{qos: header >> 1 & 0x03, retain: header&0x01 != 0, dup: header&0x08 != 0}
+			topicLength := int(body[0])<<8 | int(body[1])
+			message.topic = string(body[2 : 2+topicLength])
+			rest := body[2+topicLength:]
+			var id []byte
+			if message.qos > 0 {
+				id, rest = rest[:2], rest[2:]
+			}
+			if version == simulator.MQTTv5 {
+				rest = rest[1:]
+			}
+			message.payload = rest
+
+			b.mu.Lock()
+			b.messages = append(b.messages, message)
+			b.mu.Unlock()
+
+			switch message.qos {
+			case 1:
+				conn.Write([]byte{0x40, 2, id[0], id[1]})
+			case 2:
+				conn.Write([]byte{0x50, 2, id[0], id[1]})
+			}
+
+		case 0x60: // PUBREL
+			conn.Write([]byte{0x70, 2, body[0], body[1]})
+
+		case 0xC0: // PINGREQ
+			if !first || !b.silentPings {
+				conn.Write([]byte{0xD0, 0})
+			}
+
+		case 0xE0: // DISCONNECT
+			return
+		}
+	}
+}
+
+// readTestPacket reads one MQTT packet and returns its fixed header byte and body.
+func readTestPacket(reader *bufio.Reader) (byte, []byte, error) {
+	header, err := reader.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length, multiplier := 0, 1
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(b&0x7F) * multiplier
+		if b&0x80 == 0 {
+			break
+		}
+		multiplier *= 128
+	}
+	body := make([]byte, length)
+	_, err = io.ReadFull(reader, body)
+	return header, body, err
+}
+
+// TestMQTTSink tests publishing with both protocol versions and every QoS level, using a topic
+// template built from the sensor fields.
+func TestMQTTSink(t *testing.T) {
+	tests := []struct {
+		name    string
+		version string
+		qos     int
+	}{
+		{"v3.1.1 qos0", "3.1.1", 0},
+		{"v3.1.1 qos1", "3.1.1", 1},
+		{"v5 qos1", "5", 1},
+		{"v5 qos2", "5", 2},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			broker := newTestBroker(t)
+			sink, err := simulator.NewSink(simulator.SinkConfig{
+				Type:            "mqtt",
+				URL:             broker.url(),
+				Topic:           "plant/{location}/{id}/temperature",
+				QoS:             tc.qos,
+				Retain:          true,
+				ClientID:        "simulator-test",
+				ProtocolVersion: tc.version,
+			}, simulator.Config{}, nil)
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+
+			readings := testReadings(3)
+			captureLogs(func(logger *slog.Logger) {
+				if err := sink.Open(); err != nil {
+					t.Fatalf("Expected no error opening sink, got %v", err)
+				}
+				for _, reading := range readings {
+					if err := sink.Write(reading); err != nil {
+						t.Fatalf("Expected no error writing, got %v", err)
+					}
+				}
+				if err := sink.Close(); err != nil {
+					t.Fatalf("Expected no error closing sink, got %v", err)
+				}
+			})
+
+			// QoS 0 messages are not acknowledged, so give the broker a moment to read them.
+			deadline := time.Now().Add(time.Second)
+			for len(broker.snapshot()) < len(readings) && time.Now().Before(deadline) {
+				time.Sleep(10 * time.Millisecond)
+			}
+
+			messages := broker.snapshot()
+			if len(messages) != len(readings) {
+				t.Fatalf("Expected %d messages, got %d", len(readings), len(messages))
+			}
+			for i, message := range messages {
+				if message.topic != "plant/LocationA/001/temperature" {
+					t.Errorf("Unexpected topic %s", message.topic)
+				}
+				if int(message.qos) != tc.qos || !message.retain {
+					t.Errorf("Unexpected flags: qos %d, retain %t", message.qos, message.retain)
+				}
+				var reading simulator.TemperatureReading
+				if err := json.Unmarshal(message.payload, &reading); err != nil {
+					t.Fatalf("Error decoding payload %q: %v", message.payload, err)
+				}
+				if reading.Temperature != readings[i].Temperature {
+					t.Errorf("Expected temperature %.2f, got %.2f", readings[i].Temperature, reading.Temperature)
+				}
+			}
+
+			broker.mu.Lock()
+			defer broker.mu.Unlock()
+			wantVersion := byte(simulator.MQTTv311)
+			if tc.version == "5" {
+				wantVersion = simulator.MQTTv5
+			}
+			if broker.versions[0] != wantVersion || broker.clientIDs[0] != "simulator-test" {
+				t.Errorf("Unexpected connection: version %d, client ID %s", broker.versions[0], broker.clientIDs[0])
+			}
+		})
+	}
+}
+
+// TestMQTTSinkReconnect tests that a message interrupted by a lost connection is published again
+// after reconnecting.
+func TestMQTTSinkReconnect(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.dropPublish = 2
+	sink := &simulator.MQTTSink{
+		Broker:           broker.url(),
+		QoS:              1,
+		ReconnectBackoff: time.Millisecond,
+	}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		sink.Logger = logger
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		for _, reading := range testReadings(3) {
+			if err := sink.Write(reading); err != nil {
+				t.Fatalf("Expected no error writing, got %v", err)
+			}
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error closing sink, got %v", err)
+		}
+	})
+
+	messages := broker.snapshot()
+	if len(messages) != 3 {
+		t.Fatalf("Expected 3 acknowledged messages, got %d", len(messages))
+	}
+	if !messages[1].dup {
+		t.Error("Expected the republished message to be flagged as a duplicate")
+	}
+	if messages[0].topic != "sensors/001/temperature" {
+		t.Errorf("Unexpected default topic %s", messages[0].topic)
+	}
+	if !strings.Contains(logOutput, `level=WARN msg="Reconnecting to MQTT broker after error"`) {
+		t.Errorf("Expected log message about reconnecting, but got: %s", logOutput)
+	}
+}
+
+// TestMQTTSinkUnansweredPing tests that a connection whose pings are not answered is dropped, even at
+// QoS 0 where nothing else is read from the broker, and that the next message is published on a new
+// connection.
+func TestMQTTSinkUnansweredPing(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.silentPings = true
+	sink := &simulator.MQTTSink{Broker: broker.url(), KeepAlive: 100 * time.Millisecond, ReconnectBackoff: time.Millisecond}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		sink.Logger = logger
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		// Leave time for a ping to be sent and to go unanswered.
+		time.Sleep(300 * time.Millisecond)
+		if err := sink.Write(testReadings(1)[0]); err != nil {
+			t.Fatalf("Expected no error writing, got %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error closing sink, got %v", err)
+		}
+	})
+
+	broker.mu.Lock()
+	connections := broker.connections
+	broker.mu.Unlock()
+	if connections != 2 {
+		t.Errorf("Expected the unanswered connection to be replaced, got %d connections", connections)
+	}
+	if !strings.Contains(logOutput, `level=WARN msg="Error pinging MQTT broker"`) {
+		t.Errorf("Expected log message about the unanswered ping, but got: %s", logOutput)
+	}
+
+	// The message is sent without acknowledgement, so give the broker a moment to read it.
+	deadline := time.Now().Add(time.Second)
+	for len(broker.snapshot()) < 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if messages := broker.snapshot(); len(messages) != 1 {
+		t.Errorf("Expected 1 message, got %d", len(messages))
+	}
+}
+
+// TestMQTTSinkNoReconnects tests that a maximum of zero reconnects fails a publish as soon as the
+// connection is lost, and that negative maximums are rejected.
+func TestMQTTSinkNoReconnects(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.dropPublish = 1
+	noReconnects := 0
+	sink := &simulator.MQTTSink{Broker: broker.url(), QoS: 1, MaxReconnects: &noReconnects, ReconnectBackoff: time.Millisecond}
+
+	captureLogs(func(logger *slog.Logger) {
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		defer sink.Close()
+		if err := sink.Write(testReadings(1)[0]); err == nil {
+			t.Error("Expected error for lost connection, got nil")
+		}
+	})
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	if broker.connections != 1 {
+		t.Errorf("Expected no reconnect, got %d connections", broker.connections)
+	}
+
+	negative := -1
+	sinkConfig := simulator.SinkConfig{Type: "mqtt", URL: broker.url(), MaxRetries: &negative}
+	if _, err := simulator.NewSink(sinkConfig, simulator.Config{}, nil); err == nil {
+		t.Error("Expected error for negative max retries, got nil")
+	}
+	sink = &simulator.MQTTSink{Broker: broker.url(), MaxReconnects: &negative}
+	if err := sink.Open(); err == nil {
+		t.Error("Expected error for negative max reconnects, got nil")
+	}
+}
+
+// TestMQTTSinkCloseWhileReconnecting tests that closing the sink ends the wait before reconnecting,
+// rather than waiting for the whole backoff.
+func TestMQTTSinkCloseWhileReconnecting(t *testing.T) {
+	broker := newTestBroker(t)
+	broker.dropPublish = 1
+	sink := &simulator.MQTTSink{Broker: broker.url(), QoS: 1, ReconnectBackoff: time.Hour}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		sink.Logger = logger
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		// The broker drops the connection on the first publication and cannot be reached again.
+		broker.listener.Close()
+
+		done := make(chan error, 1)
+		go func() { done <- sink.Write(testReadings(1)[0]) }()
+		time.AfterFunc(50*time.Millisecond, func() { sink.Close() })
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Error("Expected error for interrupted publish, got nil")
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("Expected closing the sink to end the wait before reconnecting")
+		}
+	})
+	if !strings.Contains(logOutput, `msg="Stopped reconnecting to MQTT broker"`) {
+		t.Errorf("Expected log message about stopping, but got: %s", logOutput)
+	}
+}
+
+// TestMQTTSinkInvalid tests that invalid MQTT sink configurations are rejected.
+func TestMQTTSinkInvalid(t *testing.T) {
+	invalid := []simulator.SinkConfig{
+		{Type: "mqtt"},
+		{Type: "mqtt", URL: "tcp://localhost:1883", QoS: 3},
+		{Type: "mqtt", URL: "tcp://localhost:1883", ProtocolVersion: "3.1"},
+	}
+	for _, sinkConfig := range invalid {
+		if _, err := simulator.NewSink(sinkConfig, simulator.Config{}, nil); err == nil {
+			t.Errorf("Expected error for sink %+v, got nil", sinkConfig)
+		}
+	}
+
+	sink := &simulator.MQTTSink{Broker: "tcp://localhost:1883", Topic: "sensors/+/temperature"}
+	if err := sink.Open(); err == nil {
+		t.Error("Expected error for wildcard topic, got nil")
+	}
+}
+
+// TestMQTTSinkInvalidTopic tests that sensors whose fields would produce an invalid topic, or change
+// the topic hierarchy, are rejected by validation and never published.
+func TestMQTTSinkInvalidTopic(t *testing.T) {
+	sensorConfig := simulator.SensorConfig{
+		Config: simulator.Config{
+			Sinks: []simulator.SinkConfig{{Type: "mqtt", URL: "tcp://localhost:1883", Topic: "plant/{name}/{id}"}},
+		},
+		Sensors: []simulator.Sensor{
+			{Name: "Rack 1", ID: "001"},
+			{Name: "Rack/2", ID: "002"},
+			{Name: "Rack+3", ID: "003"},
+			{Name: "Rack 4", ID: "#"},
+		},
+	}
+	err := sensorConfig.Validate()
+	var validationErrs simulator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	expected := []string{
+		`sensors[1]: cannot be published by config.sinks[0]: sensor name "Rack/2" used in mqtt topic plant/{name}/{id} must not contain "+", "#", "/" or a null character`,
+		`sensors[2]: cannot be published by config.sinks[0]: sensor name "Rack+3" used in mqtt topic plant/{name}/{id} must not contain "+", "#", "/" or a null character`,
+		`sensors[3]: cannot be published by config.sinks[0]: sensor id "#" used in mqtt topic plant/{name}/{id} must not contain "+", "#", "/" or a null character`,
+	}
+	if len(validationErrs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d:\n%v", len(expected), len(validationErrs), err)
+	}
+	for i, fieldErr := range validationErrs {
+		if fieldErr.Error() != expected[i] {
+			t.Errorf("Expected problem %q, got %q", expected[i], fieldErr.Error())
+		}
+	}
+
+	// The sink itself refuses to publish such readings, as well as readings of sensors without an ID.
+	broker := newTestBroker(t)
+	sink := &simulator.MQTTSink{Broker: broker.url()}
+	captureLogs(func(logger *slog.Logger) {
+		if err := sink.Open(); err != nil {
+			t.Fatalf("Expected no error opening sink, got %v", err)
+		}
+		defer sink.Close()
+		reading := testReadings(1)[0]
+		reading.Sensor.ID = ""
+		if err := sink.Write(reading); err == nil || !strings.Contains(err.Error(), "sensor id used in mqtt topic sensors/{id}/temperature must not be empty") {
+			t.Errorf("Expected error for empty sensor ID, got %v", err)
+		}
+		reading.Sensor.ID = "a/b"
+		if err := sink.Write(reading); err == nil {
+			t.Error("Expected error for sensor ID with a level separator, got nil")
+		}
+	})
+	if messages := broker.snapshot(); len(messages) != 0 {
+		t.Errorf("Expected no messages, got %d", len(messages))
+	}
+}
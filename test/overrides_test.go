@@ -0,0 +1,136 @@
+package test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestConfigOptions tests that every configuration setting has an environment variable and a flag.
+func TestConfigOptions(t *testing.T) {
+	options := make(map[string]simulator.ConfigOption)
+	for _, option := range simulator.ConfigOptions() {
+		options[option.Key] = option
+	}
+
+	configType := reflect.TypeOf(simulator.Config{})
+	for i := 0; i < configType.NumField(); i++ {
+		key, _, _ := strings.Cut(configType.Field(i).Tag.Get("json"), ",")
+		option, ok := options[key]
+		if !ok {
+			t.Errorf("Expected an option for setting %s", key)
+			continue
+		}
+		if !strings.HasPrefix(option.Env, simulator.EnvPrefix) || option.Flag == "" || option.Usage == "" {
+			t.Errorf("Incomplete option %+v", option)
+		}
+	}
+
+	if option := options["totalReadings"]; option.Env != "TEMPSIM_TOTAL_READINGS" || option.Flag != "total_readings" {
+		t.Errorf("Unexpected names for totalReadings: %s, %s", option.Env, option.Flag)
+	}
+	if option := options["outputFileName"]; option.Env != "TEMPSIM_OUTPUT_FILE" || option.Flag != "output_file" {
+		t.Errorf("Unexpected names for outputFileName: %s, %s", option.Env, option.Flag)
+	}
+	if !options["simulate"].Bool || options["seed"].Bool || options["mode"].Bool {
+		t.Errorf("Expected only boolean settings to be marked as such")
+	}
+}
+
+// TestApplyEnv tests that environment variables override settings of every type, and leave settings
+// without a variable alone.
+func TestApplyEnv(t *testing.T) {
+	env := map[string]string{
+		"TEMPSIM_TOTAL_READINGS": "25",
+		"TEMPSIM_MAX_TEMP":       "80.5",
+		"TEMPSIM_MODE":           "accelerated",
+		"TEMPSIM_SIMULATE":       "true",
+		"TEMPSIM_SEED":           "42",
+		"TEMPSIM_INTERVAL":       "30s",
+		"TEMPSIM_CSV_COLUMNS":    "id, temperature",
+		"TEMPSIM_SINKS":          `[{"type": "stdout", "format": "csv"}]`,
+		"TEMPSIM_OUTPUT_FORMAT":  "",
+	}
+	config := simulator.Config{TotalReadings: 10, MinTemp: -10.0, MaxTemp: 50.0, OutputFormat: "json"}
+	err := config.ApplyEnv(func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	})
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	expected := simulator.Config{
+		TotalReadings: 25,
+		MinTemp:       -10.0,
+		MaxTemp:       80.5,
+		Mode:          simulator.ModeAccelerated,
+		Simulate:      true,
+		Seed:          42,
+		Interval:      simulator.Duration(30 * time.Second),
+		CSVColumns:    []string{"id", "temperature"},
+		Sinks:         []simulator.SinkConfig{{Type: "stdout", Format: "csv"}},
+	}
+	if !reflect.DeepEqual(config, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, config)
+	}
+}
+
+// TestConfigSetInvalid tests that values that cannot be parsed and unknown settings are rejected,
+// naming the setting.
+func TestConfigSetInvalid(t *testing.T) {
+	tests := []struct {
+		key      string
+		value    string
+		expected string
+	}{
+		{"totalReadings", "ten", `invalid value "ten" for totalReadings`},
+		{"interval", "10", `invalid value "10" for interval`},
+		{"simulate", "maybe", `invalid value "maybe" for simulate`},
+		{"sinks", "stdout", `invalid value "stdout" for sinks`},
+		{"sinks", `[{"type": "influx", "tokn": "secret"}]`, `invalid value "[{\"type\": \"influx\", \"tokn\": \"secret\"}]" for sinks: unknown field [0].tokn`},
+		{"maxTemprature", "50", "unknown configuration setting maxTemprature"},
+	}
+	for _, tc := range tests {
+		var config simulator.Config
+		err := config.Set(tc.key, tc.value)
+		if err == nil || !strings.Contains(err.Error(), tc.expected) {
+			t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+		}
+	}
+
+	var config simulator.Config
+	err := config.ApplyEnv(func(name string) (string, bool) {
+		return "abc", name == "TEMPSIM_SEED"
+	})
+	if err == nil || !strings.HasPrefix(err.Error(), "TEMPSIM_SEED: ") {
+		t.Errorf("Expected error naming the variable, got %v", err)
+	}
+}
+
+// TestConfigRedacted tests that sink secrets are replaced in a redacted copy, leaving the original
+// configuration and unset secrets alone.
+func TestConfigRedacted(t *testing.T) {
+	config := simulator.Config{Sinks: []simulator.SinkConfig{
+		{Type: "influx", URL: "http://localhost:8086", Token: "secret-token"},
+		{Type: "mqtt", URL: "tcp://localhost:1883", Username: "sim", Password: "secret-password"},
+		{Type: "stdout"},
+	}}
+
+	redacted := config.Redacted()
+	if sink := redacted.Sinks[0]; sink.Token != "REDACTED" || sink.URL != "http://localhost:8086" {
+		t.Errorf("Expected the influx token to be redacted, got %+v", sink)
+	}
+	if sink := redacted.Sinks[1]; sink.Password != "REDACTED" || sink.Username != "sim" {
+		t.Errorf("Expected the mqtt password to be redacted, got %+v", sink)
+	}
+	if sink := redacted.Sinks[2]; sink.Token != "" || sink.Password != "" {
+		t.Errorf("Expected unset secrets to stay empty, got %+v", sink)
+	}
+	if config.Sinks[0].Token != "secret-token" || config.Sinks[1].Password != "secret-password" {
+		t.Errorf("Expected the original configuration to keep its secrets, got %+v", config.Sinks)
+	}
+}
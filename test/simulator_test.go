@@ -5,49 +5,107 @@ package test
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"reflect"
+	"regexp"
+	"strconv"
 	"strings"
 	"testing"
+	"time"
 
 	"temperature-simulator/internal/simulator"
 )
 
 // captureLogs is a helper function that captures logs generated during the execution
-// of the provided function. It sets up log output to a buffer to capture logs, ensuring
+// of the provided function. It passes the function a debug-level text logger writing to a buffer,
+// and installs the same logger as the default one for code that is not given a logger, ensuring
 // that any logs produced during the test can be properly validated.
-func captureLogs(f func()) string {
+func captureLogs(f func(logger *slog.Logger)) string {
 	var buf bytes.Buffer
-	origLogger := log.Default()              // Store the original logger
-	log.SetOutput(&buf)                      // Redirect log output to buffer
-	defer log.SetOutput(origLogger.Writer()) // Restore original logger after the test
+	logger := slog.New(slog.NewTextHandler(&buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	origLogger := slog.Default()      // Store the original default logger
+	slog.SetDefault(logger)           // Redirect default log output to buffer
+	defer slog.SetDefault(origLogger) // Restore original default logger after the test
 
 	// Execute the provided function.
-	f()
+	f(logger)
 
 	// Return the captured logs as a string.
 	return buf.String()
 }
 
+// generateSensor generates the readings of a single sensor, one per minute from midnight, without
+// fluctuation. The sensor JSON is given without braces, name and ID, e.g. `"model": {"name": "cyclic"}`.
+// It returns the readings and the logs of the run.
+func generateSensor(t *testing.T, totalReadings int, sensor string) ([]simulator.TemperatureReading, string) {
+	t.Helper()
+	var sensorConfig simulator.SensorConfig
+	configJSON := fmt.Sprintf(`{
+		"config": {"totalReadings": %d, "startingTemp": 20.0, "maxTempIncrease": 10.0, "minTemp": -100.0,
+			"maxTemp": 100.0, "mode": "backfill", "seed": 1, "startTime": "2024-03-01T00:00:00Z",
+			"outputFileName": "out.json"},
+		"sensors": [{"name": "SensorA", "id": "001", %s}]
+	}`, totalReadings, sensor)
+	if err := json.Unmarshal([]byte(configJSON), &sensorConfig); err != nil {
+		t.Fatalf("Error decoding configuration: %v", err)
+	}
+	if err := sensorConfig.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, got:\n%v", err)
+	}
+
+	generator := &simulator.Generator{Sensors: sensorConfig.Sensors, Config: sensorConfig.Config}
+	var data []simulator.TemperatureReading
+	logs := captureLogs(func(logger *slog.Logger) {
+		generator.Logger = logger
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+	return data, logs
+}
+
+// fakeClock is a simulator.Clock whose time only moves when the simulator waits on it.
+// Waiting returns immediately after advancing the clock, so real-time runs complete instantly.
+// A latency makes every wait overshoot by that much, like a loaded system would.
+type fakeClock struct {
+	now     time.Time
+	waited  time.Duration
+	latency time.Duration
+}
+
+// Now returns the fake current time.
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+// After advances the fake time by d plus the latency and returns a channel that is already ready.
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.now = c.now.Add(d + c.latency)
+	c.waited += d
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
 // TestLoadConfigAndSensors tests the loading of sensor configurations from a JSON file.
 // It verifies that the function correctly loads valid configurations, handles invalid file paths,
 // and logs the appropriate messages.
 func TestLoadConfigAndSensors(t *testing.T) {
-	// Set up the logger for capturing logs. Ensure that logs are written to stdout during the test.
-	if err := simulator.SetupLogger("info", "stdout"); err != nil {
-		t.Fatalf("Failed to set up logger: %v", err)
-	}
-
 	// Define the path to the external JSON configuration file.
 	configFilePath := filepath.Join("..", "configs", "test_sensors.json")
 
 	// Capture logs during valid configuration loading.
-	logOutput := captureLogs(func() {
+	logOutput := captureLogs(func(logger *slog.Logger) {
 		// Test loading valid configuration and sensors.
-		sensorConfig, err := simulator.LoadConfigAndSensors(configFilePath)
+		sensorConfig, err := simulator.LoadConfigAndSensors(configFilePath, logger, simulator.LoadOptions{})
 		if err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
@@ -57,7 +115,7 @@ func TestLoadConfigAndSensors(t *testing.T) {
 	})
 
 	// Check if log contains a message about loading sensors.
-	if !strings.Contains(logOutput, "Loaded 2 sensors from configuration") {
+	if !strings.Contains(logOutput, `msg="Loaded sensors from configuration" count=2`) {
 		t.Errorf("Expected log message about loading 2 sensors, but got: %s", logOutput)
 	}
 
@@ -65,29 +123,243 @@ func TestLoadConfigAndSensors(t *testing.T) {
 	invalidConfigFilePath := filepath.Join("..", "configs", "nonexistent.json")
 
 	// Capture logs for invalid configuration loading.
-	logOutput = captureLogs(func() {
-		_, err := simulator.LoadConfigAndSensors(invalidConfigFilePath)
+	logOutput = captureLogs(func(logger *slog.Logger) {
+		_, err := simulator.LoadConfigAndSensors(invalidConfigFilePath, logger, simulator.LoadOptions{})
 		if err == nil {
 			t.Error("Expected error for invalid configuration file path, got nil")
 		}
 	})
 
 	// Check if log contains an error message about file loading failure.
-	if !strings.Contains(logOutput, "Error opening configuration file") {
+	if !strings.Contains(logOutput, `level=ERROR msg="Error opening configuration file"`) {
 		t.Errorf("Expected log message about error opening configuration file, but got: %s", logOutput)
 	}
 }
 
+// TestLoadConfigStrict tests that unknown keys, malformed values and trailing data in a
+// configuration file are rejected with their line and column, and that unknown keys can be allowed.
+func TestLoadConfigStrict(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{
+			name:     "unknown field",
+			config:   "{\n  \"config\": {\n    \"maxTemprature\": 50\n  },\n  \"sensors\": [{\"id\": \"001\"}]\n}",
+			expected: "line 3, column 5: unknown field config.maxTemprature",
+		},
+		{
+			name:     "unknown sensor field",
+			config:   "{\"sensors\": [\n  {\"id\": \"001\"},\n  {\"id\": \"002\", \"locaton\": \"Rack 2\"}\n]}",
+			expected: "line 3, column 17: unknown field sensors[1].locaton",
+		},
+		{
+			name:     "wrong type",
+			config:   "{\"config\": {\n  \"totalReadings\": \"ten\"\n}, \"sensors\": [{\"id\": \"001\"}]}",
+			expected: "line 2, column 24: cannot use string as int for config.totalReadings",
+		},
+		{
+			name:     "trailing data",
+			config:   "{\"sensors\": [{\"id\": \"001\"}]}\n}",
+			expected: "line 2, column 1: unexpected data after the end of the configuration",
+		},
+		{
+			name:     "syntax error",
+			config:   "{\"sensors\": [{\"id\": \"001\"}],\n}",
+			expected: "line 2, column 1: invalid character '}'",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "sensors.json")
+			if err := os.WriteFile(configPath, []byte(tc.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			captureLogs(func(logger *slog.Logger) {
+				_, err := simulator.LoadConfigAndSensors(configPath, logger, simulator.LoadOptions{})
+				if err == nil || !strings.Contains(err.Error(), tc.expected) {
+					t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+				}
+			})
+		})
+	}
+
+	// With unknown fields allowed, the file loads and the unknown key is logged as a warning.
+	configPath := filepath.Join(t.TempDir(), "sensors.json")
+	if err := os.WriteFile(configPath, []byte(tests[0].config), 0644); err != nil {
+		t.Fatal(err)
+	}
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		if _, err := simulator.LoadConfigAndSensors(configPath, logger, simulator.LoadOptions{AllowUnknownFields: true}); err != nil {
+			t.Errorf("Expected no error with unknown fields allowed, got %v", err)
+		}
+	})
+	if !strings.Contains(logOutput, "level=WARN") || !strings.Contains(logOutput, tests[0].expected) {
+		t.Errorf("Expected warning about the unknown field, but got: %s", logOutput)
+	}
+}
+
+// TestLoadConfigFormats tests that the same configuration written as JSON, YAML and TOML loads into
+// identical structs, which pass validation.
+func TestLoadConfigFormats(t *testing.T) {
+	var loaded []*simulator.SensorConfig
+	for _, name := range []string{"sensors.json", "sensors.yaml", "sensors.toml"} {
+		captureLogs(func(logger *slog.Logger) {
+			sensorConfig, err := simulator.LoadConfigAndSensors(filepath.Join("testdata", name), logger, simulator.LoadOptions{})
+			if err != nil {
+				t.Fatalf("Expected no error loading %s, got %v", name, err)
+			}
+			if err := sensorConfig.Validate(); err != nil {
+				t.Errorf("Expected %s to be valid, got:\n%v", name, err)
+			}
+			loaded = append(loaded, sensorConfig)
+		})
+	}
+
+	if loaded[0].Config.StartTime != "2024-01-01T00:00:00Z" || loaded[0].Sensors[1].Interval != simulator.Duration(30*time.Second) {
+		t.Fatalf("Unexpected JSON configuration: %+v", loaded[0])
+	}
+	for i, format := range []string{"YAML", "TOML"} {
+		if !reflect.DeepEqual(loaded[i+1], loaded[0]) {
+			t.Errorf("Expected the %s configuration to match the JSON one:\n%+v\n%+v", format, loaded[i+1], loaded[0])
+		}
+	}
+}
+
+// TestLoadConfigFormatErrors tests that YAML and TOML files are decoded as strictly as JSON ones, and
+// that errors in YAML files are located by line and column.
+func TestLoadConfigFormatErrors(t *testing.T) {
+	tests := []struct {
+		name     string
+		file     string
+		config   string
+		expected string
+	}{
+		{
+			name:     "yaml unknown field",
+			file:     "sensors.yaml",
+			config:   "config:\n  maxTemprature: 50\nsensors:\n  - id: \"001\"\n",
+			expected: "line 2, column 3: unknown field config.maxTemprature",
+		},
+		{
+			name:     "yaml unknown sensor field",
+			file:     "sensors.yml",
+			config:   "sensors:\n  - id: \"001\"\n  - id: \"002\"\n    locaton: Rack 2\n",
+			expected: "line 4, column 5: unknown field sensors[1].locaton",
+		},
+		{
+			name:     "yaml wrong type",
+			file:     "sensors.yaml",
+			config:   "config:\n  totalReadings: ten\nsensors:\n  - id: \"001\"\n",
+			expected: "line 2, column 3: cannot use string as int for config.totalReadings",
+		},
+		{
+			name:     "yaml wrong sensor field type",
+			file:     "sensors.yaml",
+			config:   "sensors:\n  - id: \"001\"\n  - id: \"002\"\n    maxTemp: hot\n",
+			expected: "line 4, column 5: cannot use string as float64 for sensors[1].maxTemp",
+		},
+		{
+			name:     "yaml second document",
+			file:     "sensors.yaml",
+			config:   "sensors:\n  - id: \"001\"\n---\nsensors: []\n",
+			expected: "line 3, column 1: unexpected data after the end of the configuration",
+		},
+		{
+			name:     "yaml duplicate key",
+			file:     "sensors.yaml",
+			config:   "sensors:\n  - id: \"001\"\nsensors: []\n",
+			expected: `line 3, column 1: key "sensors" is already set on line 1`,
+		},
+		{
+			name:     "toml unknown field",
+			file:     "sensors.toml",
+			config:   "[config]\nmaxTemprature = 50\n\n[[sensors]]\nid = \"001\"\n",
+			expected: "unknown field config.maxTemprature",
+		},
+		{
+			name:     "toml syntax error",
+			file:     "sensors.toml",
+			config:   "[[sensors]]\nid = \"001\n",
+			expected: "line 2",
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), tc.file)
+			if err := os.WriteFile(configPath, []byte(tc.config), 0644); err != nil {
+				t.Fatal(err)
+			}
+			captureLogs(func(logger *slog.Logger) {
+				_, err := simulator.LoadConfigAndSensors(configPath, logger, simulator.LoadOptions{})
+				if err == nil || !strings.Contains(err.Error(), tc.expected) {
+					t.Errorf("Expected error containing %q, got %v", tc.expected, err)
+				}
+			})
+		})
+	}
+}
+
+// TestNewLogger tests that the logger discards messages below the configured level, writes JSON
+// records when the JSON format is selected, and rejects unknown levels and formats.
+func TestNewLogger(t *testing.T) {
+	logPath := filepath.Join(t.TempDir(), "simulator.log")
+
+	logger, closer, err := simulator.NewLogger("warn", logPath, "json")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	logger.Info("Dropped message")
+	logger.Warn("Kept message", "count", 3)
+	if err := closer.Close(); err != nil {
+		t.Fatalf("Expected no error closing the log file, got %v", err)
+	}
+
+	content, err := os.ReadFile(logPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != 1 {
+		t.Fatalf("Expected 1 log record, got %d: %s", len(lines), content)
+	}
+	var record struct {
+		Level string `json:"level"`
+		Msg   string `json:"msg"`
+		Count int    `json:"count"`
+	}
+	if err := json.Unmarshal([]byte(lines[0]), &record); err != nil {
+		t.Fatalf("Expected a JSON log record, got %s: %v", lines[0], err)
+	}
+	if record.Level != "WARN" || record.Msg != "Kept message" || record.Count != 3 {
+		t.Errorf("Unexpected log record: %+v", record)
+	}
+
+	if _, _, err := simulator.NewLogger("verbose", "stdout", "text"); err == nil {
+		t.Error("Expected error for unknown log level, got nil")
+	}
+	if _, _, err := simulator.NewLogger("info", "stdout", "xml"); err == nil {
+		t.Error("Expected error for unknown log format, got nil")
+	}
+
+	// An unknown format is rejected before the log file is created.
+	xmlPath := filepath.Join(t.TempDir(), "simulator.xml.log")
+	if _, _, err := simulator.NewLogger("info", xmlPath, "xml"); err == nil {
+		t.Error("Expected error for unknown log format, got nil")
+	}
+	if _, err := os.Stat(xmlPath); !os.IsNotExist(err) {
+		t.Errorf("Expected no log file for an unknown format, got %v", err)
+	}
+}
+
 // TestGenerateTemperatureReadings tests the generation of temperature readings
 // for a given set of sensors and configuration. It verifies that the correct number
 // of readings are generated, that the temperatures fall within the expected range,
 // and that appropriate logging occurs during the generation process.
 func TestGenerateTemperatureReadings(t *testing.T) {
-	// Set up the logger for capturing logs.
-	if err := simulator.SetupLogger("info", "stdout"); err != nil {
-		t.Fatalf("Failed to set up logger: %v", err)
-	}
-
 	// Create a set of sensor objects to simulate.
 	sensors := []simulator.Sensor{
 		{
@@ -116,7 +388,7 @@ func TestGenerateTemperatureReadings(t *testing.T) {
 	}
 
 	// Capture logs during temperature reading generation.
-	logOutput := captureLogs(func() {
+	logOutput := captureLogs(func(logger *slog.Logger) {
 		// Generate temperature readings.
 		data, err := simulator.GenerateTemperatureReadings(
 			sensors,
@@ -154,17 +426,625 @@ func TestGenerateTemperatureReadings(t *testing.T) {
 	if !strings.Contains(logOutput, "Completed temperature generation") {
 		t.Errorf("Expected log message about completed temperature generation, but got: %s", logOutput)
 	}
+
+	// Zero readings yield none, as before runs without an end existed.
+	captureLogs(func(logger *slog.Logger) {
+		data, err := simulator.GenerateTemperatureReadings(sensors, 0, 20.0, 30.0, 3.0, -10.0, 50.0, true)
+		if err != nil || len(data) != 0 {
+			t.Errorf("Expected no readings and no error for zero total readings, got %d readings and %v", len(data), err)
+		}
+	})
+
+	// A negative number of readings must be rejected rather than allocated.
+	captureLogs(func(logger *slog.Logger) {
+		_, err := simulator.GenerateTemperatureReadings(sensors, -1, 20.0, 30.0, 3.0, -10.0, 50.0, true)
+		if err == nil || !strings.Contains(err.Error(), "must not be negative") {
+			t.Errorf("Expected error for negative total readings, got %v", err)
+		}
+	})
+}
+
+// TestGeneratorSeeded tests that two runs with the same seed produce identical readings, including
+// timestamps, and that the seed is recorded in the readings and the logs.
+func TestGeneratorSeeded(t *testing.T) {
+	sensors := []simulator.Sensor{
+		{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"},
+		{Name: "SensorB", ID: "002", Version: "v1.1", Location: "LocationB"},
+	}
+	const seed int64 = 42
+
+	// generate runs a seeded simulation and returns the readings encoded as JSON.
+	generate := func() []byte {
+		generator := &simulator.Generator{
+			Sensors: sensors,
+			Config: simulator.Config{
+				TotalReadings:   100,
+				StartingTemp:    20.0,
+				MaxTempIncrease: 30.0,
+				TempFluctuation: 3.0,
+				MinTemp:         -10.0,
+				MaxTemp:         50.0,
+				Simulate:        true,
+				Seed:            seed,
+			},
+		}
+		data, err := generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		for i, reading := range data {
+			if reading.Seed != seed {
+				t.Fatalf("Expected seed %d on reading %d, got %d", seed, i, reading.Seed)
+			}
+		}
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			t.Fatalf("Error encoding readings: %v", err)
+		}
+		return encoded
+	}
+
+	var first, second []byte
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		first = generate()
+		second = generate()
+	})
+
+	if !bytes.Equal(first, second) {
+		t.Error("Expected identical readings for runs with the same seed")
+	}
+	if !strings.Contains(logOutput, `msg="Using random seed" seed=42`) {
+		t.Errorf("Expected log message about the random seed, but got: %s", logOutput)
+	}
+}
+
+// TestGeneratorReplayUnseeded tests that an unseeded run can be replayed from the seed and start time
+// it logs.
+func TestGeneratorReplayUnseeded(t *testing.T) {
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{
+			{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"},
+			{Name: "SensorB", ID: "002", Version: "v1.1", Location: "LocationB"},
+		},
+		Config: simulator.Config{
+			TotalReadings:   50,
+			StartingTemp:    20.0,
+			MaxTempIncrease: 30.0,
+			TempFluctuation: 3.0,
+			MinTemp:         -10.0,
+			MaxTemp:         50.0,
+			Mode:            simulator.ModeBackfill,
+		},
+	}
+
+	// generate runs the simulation and returns the readings encoded as JSON, and the logs.
+	generate := func() ([]byte, string) {
+		var data []simulator.TemperatureReading
+		logOutput := captureLogs(func(logger *slog.Logger) {
+			var err error
+			data, err = generator.Generate()
+			if err != nil {
+				t.Fatalf("Expected no error, got %v", err)
+			}
+		})
+		encoded, err := json.Marshal(data)
+		if err != nil {
+			t.Fatalf("Error encoding readings: %v", err)
+		}
+		return encoded, logOutput
+	}
+
+	original, logOutput := generate()
+	match := regexp.MustCompile(`msg="Using random seed" seed=(-?\d+) startTime=(\S+)`).FindStringSubmatch(logOutput)
+	if match == nil {
+		t.Fatalf("Expected log message with the seed and start time, but got: %s", logOutput)
+	}
+	seed, err := strconv.ParseInt(match[1], 10, 64)
+	if err != nil {
+		t.Fatalf("Error parsing logged seed %q: %v", match[1], err)
+	}
+
+	generator.Config.Seed = seed
+	generator.Config.StartTime = match[2]
+	replayed, _ := generate()
+	if !bytes.Equal(original, replayed) {
+		t.Errorf("Expected the replayed run to match the original, got\n%s\ninstead of\n%s", replayed, original)
+	}
+}
+
+// TestGeneratorStartTime tests that a simulated run starts at the configured start time.
+func TestGeneratorStartTime(t *testing.T) {
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"}},
+		Config: simulator.Config{
+			TotalReadings: 3,
+			StartingTemp:  20.0,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeBackfill,
+			StartTime:     "2024-03-01T00:00:00Z",
+		},
+	}
+
+	var data []simulator.TemperatureReading
+	captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	expected := []string{"2024-03-01 00:01:00", "2024-03-01 00:02:00", "2024-03-01 00:03:00"}
+	for i, reading := range data {
+		if reading.Time != expected[i] {
+			t.Errorf("Expected time %s for reading %d, got %s", expected[i], i, reading.Time)
+		}
+	}
+
+	// An invalid start time must be rejected.
+	generator.Config.StartTime = "March 1st"
+	captureLogs(func(logger *slog.Logger) {
+		if _, err := generator.Generate(); err == nil {
+			t.Error("Expected error for invalid start time, got nil")
+		}
+	})
+}
+
+// TestGeneratorRealTimePacing tests that a real-time run waits one minute on the clock per reading
+// and stamps each reading with the time of the clock.
+func TestGeneratorRealTimePacing(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"}},
+		Config: simulator.Config{
+			TotalReadings: 5,
+			StartingTemp:  20.0,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeRealtime,
+			Seed:          7,
+		},
+		Clock: clock,
+	}
+
+	var data []simulator.TemperatureReading
+	captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	if clock.waited != 5*time.Minute {
+		t.Errorf("Expected the generator to wait 5m, waited %s", clock.waited)
+	}
+	if len(data) != 5 {
+		t.Fatalf("Expected 5 readings, got %d", len(data))
+	}
+	if data[0].Time != "2024-03-01 12:01:00" || data[4].Time != "2024-03-01 12:05:00" {
+		t.Errorf("Unexpected timestamps: first %s, last %s", data[0].Time, data[4].Time)
+	}
+}
+
+// TestGeneratorAcceleratedPacing tests that an accelerated run advances simulated time sixty times
+// faster than the clock and stamps each reading with its simulated time.
+func TestGeneratorAcceleratedPacing(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)}
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"}},
+		Config: simulator.Config{
+			TotalReadings: 5,
+			StartingTemp:  20.0,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeAccelerated,
+			StartTime:     "2023-06-01T00:00:00Z",
+		},
+		Clock: clock,
+	}
+
+	var data []simulator.TemperatureReading
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	if clock.waited != 5*time.Second {
+		t.Errorf("Expected the generator to wait 5s, waited %s", clock.waited)
+	}
+	if len(data) != 5 {
+		t.Fatalf("Expected 5 readings, got %d", len(data))
+	}
+	if data[0].Time != "2023-06-01 00:01:00" || data[4].Time != "2023-06-01 00:05:00" {
+		t.Errorf("Unexpected timestamps: first %s, last %s", data[0].Time, data[4].Time)
+	}
+	if !strings.Contains(logOutput, `msg="Using run mode" mode=accelerated`) {
+		t.Errorf("Expected log message about the run mode, but got: %s", logOutput)
+	}
+}
+
+// TestGeneratorTimeScale tests that the configured time scale sets the speed of an accelerated run,
+// and that waits overshooting their deadline do not accumulate into drift.
+func TestGeneratorTimeScale(t *testing.T) {
+	start := time.Date(2024, time.March, 1, 12, 0, 0, 0, time.UTC)
+	clock := &fakeClock{now: start, latency: 10 * time.Millisecond}
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}},
+		Config: simulator.Config{
+			TotalReadings: 60,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeAccelerated,
+			TimeScale:     600,
+			Seed:          7,
+		},
+		Clock: clock,
+	}
+
+	var data []simulator.TemperatureReading
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		generator.Logger = logger
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	// One simulated hour at 600 times the speed of the clock takes six seconds; only the latency of
+	// the last wait may be added, not the latency of every wait.
+	if elapsed := clock.now.Sub(start); elapsed != 6*time.Second+clock.latency {
+		t.Errorf("Expected the run to take 6.01s on the clock, took %s", elapsed)
+	}
+	if len(data) != 60 || data[59].Time != "2024-01-01 01:00:00" {
+		t.Errorf("Expected 60 readings ending one simulated hour after the start, got %d", len(data))
+	}
+	if !strings.Contains(logOutput, `msg="Using run mode" mode=accelerated timeScale=600`) {
+		t.Errorf("Expected log message about the time scale, but got: %s", logOutput)
+	}
+
+	// A negative time scale must be rejected.
+	generator.Config.TimeScale = -1
+	captureLogs(func(logger *slog.Logger) {
+		if _, err := generator.Generate(); err == nil {
+			t.Error("Expected error for negative time scale, got nil")
+		}
+	})
+}
+
+// TestGeneratorDuration tests that a run bounded in simulated time stops at its duration or at its
+// end time, whichever comes first, and at the total number of readings if that is reached earlier.
+func TestGeneratorDuration(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   simulator.Config
+		expected int
+	}{
+		{"duration", simulator.Config{Duration: simulator.Duration(10 * time.Minute)}, 10},
+		{"until", simulator.Config{Until: "2024-03-01T00:30:30Z"}, 30},
+		{"earlier until", simulator.Config{Duration: simulator.Duration(time.Hour), Until: "2024-03-01T00:05:00Z"}, 5},
+		{"fewer readings", simulator.Config{Duration: simulator.Duration(time.Hour), TotalReadings: 3}, 3},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := tc.config
+			config.MinTemp, config.MaxTemp = -10.0, 50.0
+			config.Mode = simulator.ModeBackfill
+			config.StartTime = "2024-03-01T00:00:00Z"
+			generator := &simulator.Generator{Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}}, Config: config}
+
+			var data []simulator.TemperatureReading
+			captureLogs(func(logger *slog.Logger) {
+				var err error
+				data, err = generator.Generate()
+				if err != nil {
+					t.Fatalf("Expected no error, got %v", err)
+				}
+			})
+			if len(data) != tc.expected {
+				t.Errorf("Expected %d readings, got %d", tc.expected, len(data))
+			}
+		})
+	}
+}
+
+// TestGeneratorRunForever tests that a run without totalReadings, duration or until keeps producing
+// readings until it is cancelled, and that such a run cannot be collected in memory.
+func TestGeneratorRunForever(t *testing.T) {
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}, {Name: "SensorB", ID: "002"}},
+		Config: simulator.Config{
+			MinTemp: -10.0,
+			MaxTemp: 50.0,
+			Mode:    simulator.ModeBackfill,
+			Seed:    7,
+		},
+	}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		generator.Logger = logger
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		readings := make(chan simulator.TemperatureReading)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- generator.Stream(ctx, readings)
+		}()
+
+		// Far more readings than any fixed count in the configuration would allow.
+		for i := 0; i < 10000; i++ {
+			if _, ok := <-readings; !ok {
+				t.Fatalf("Expected reading %d, channel was closed", i)
+			}
+		}
+		cancel()
+		for range readings {
+		}
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+
+		if _, err := generator.Generate(); err == nil {
+			t.Error("Expected error collecting an unbounded run, got nil")
+		}
+	})
+
+	if !strings.Contains(logOutput, "Generating readings until cancelled") {
+		t.Errorf("Expected log message about an unbounded run, but got: %s", logOutput)
+	}
+}
+
+// TestConfigRunMode tests that the run mode is taken from the mode setting, that the deprecated
+// simulate flag is mapped to a run mode when no mode is set, and that unknown modes are rejected.
+func TestConfigRunMode(t *testing.T) {
+	tests := []struct {
+		config   string
+		expected simulator.RunMode
+	}{
+		{`{"simulate": true}`, simulator.ModeBackfill},
+		{`{"simulate": false}`, simulator.ModeRealtime},
+		{`{}`, simulator.ModeRealtime},
+		{`{"mode": "accelerated", "simulate": true}`, simulator.ModeAccelerated},
+		{`{"mode": "Backfill"}`, simulator.ModeBackfill},
+	}
+	for _, tc := range tests {
+		var config simulator.Config
+		if err := json.Unmarshal([]byte(tc.config), &config); err != nil {
+			t.Fatalf("Error decoding configuration %s: %v", tc.config, err)
+		}
+		mode, err := config.RunMode()
+		if err != nil {
+			t.Errorf("Expected no error for %s, got %v", tc.config, err)
+		}
+		if mode != tc.expected {
+			t.Errorf("Expected mode %s for %s, got %s", tc.expected, tc.config, mode)
+		}
+	}
+
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}},
+		Config:  simulator.Config{TotalReadings: 1, Mode: "turbo"},
+	}
+	captureLogs(func(logger *slog.Logger) {
+		if _, err := generator.Generate(); err == nil {
+			t.Error("Expected error for unknown run mode, got nil")
+		}
+	})
+}
+
+// TestGeneratorIntervals tests that sensors read at their own intervals, that readings are returned
+// in time order, and that the hourly increase is spread over the increase period for any interval.
+func TestGeneratorIntervals(t *testing.T) {
+	// Decode the configuration from JSON to exercise the duration format.
+	var sensorConfig simulator.SensorConfig
+	configJSON := `{
+		"config": {"totalReadings": 10, "startingTemp": 20.0, "maxTempIncrease": 10.0, "minTemp": -100.0,
+			"maxTemp": 100.0, "mode": "backfill", "startTime": "2024-03-01T00:00:00Z", "interval": "30s"},
+		"sensors": [
+			{"name": "Thermocouple", "id": "001"},
+			{"name": "Building", "id": "002", "interval": "15m"}
+		]
+	}`
+	if err := json.Unmarshal([]byte(configJSON), &sensorConfig); err != nil {
+		t.Fatalf("Error decoding configuration: %v", err)
+	}
+
+	generator := &simulator.Generator{Sensors: sensorConfig.Sensors, Config: sensorConfig.Config}
+	var data []simulator.TemperatureReading
+	captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	if len(data) != 20 {
+		t.Fatalf("Expected 20 readings, got %d", len(data))
+	}
+
+	// Readings must be in time order across sensors.
+	for i := 1; i < len(data); i++ {
+		if data[i].Time < data[i-1].Time {
+			t.Errorf("Reading %d at %s is earlier than reading %d at %s", i, data[i].Time, i-1, data[i-1].Time)
+		}
+	}
+
+	// Without fluctuation, each sensor gains the full increase during the first five minutes.
+	last := map[string]simulator.TemperatureReading{}
+	for _, reading := range data {
+		last[reading.Sensor.ID] = reading
+	}
+	if last["001"].Time != "2024-03-01 00:05:00" || float64(last["001"].Temperature) != 30.0 {
+		t.Errorf("Unexpected last thermocouple reading: %+v", last["001"])
+	}
+	if last["002"].Time != "2024-03-01 02:30:00" {
+		t.Errorf("Unexpected last building reading time: %s", last["002"].Time)
+	}
+	if diff := float64(last["002"].Temperature) - 50.0; diff > 1e-9 || diff < -1e-9 {
+		t.Errorf("Expected building sensor to gain 10 degrees per hour started, got %.2f", last["002"].Temperature)
+	}
+
+	// The per-sensor interval is a setting, not metadata, so it must not be written with readings.
+	encoded, err := json.Marshal(last["002"])
+	if err != nil {
+		t.Fatalf("Error encoding reading: %v", err)
+	}
+	if strings.Contains(string(encoded), "interval") {
+		t.Errorf("Expected reading without interval, got %s", encoded)
+	}
+}
+
+// TestGeneratorSensorOverrides tests that sensors simulate with their own temperature parameters,
+// falling back to the global ones for parameters they do not override.
+func TestGeneratorSensorOverrides(t *testing.T) {
+	var sensorConfig simulator.SensorConfig
+	configJSON := `{
+		"config": {"totalReadings": 30, "startingTemp": 20.0, "maxTempIncrease": 10.0, "tempFluctuation": 2.0,
+			"minTemp": 0.0, "maxTemp": 40.0, "mode": "backfill", "seed": 7, "outputFileName": "out.json"},
+		"sensors": [
+			{"name": "Freezer", "id": "001", "startingTemp": -18.0, "minTemp": -25.0, "maxTemp": -15.0, "tempFluctuation": 0.5},
+			{"name": "Furnace", "id": "002", "startingTemp": 800.0, "minTemp": 750.0, "maxTemp": 900.0, "maxTempIncrease": 50.0},
+			{"name": "Office", "id": "003"}
+		]
+	}`
+	if err := json.Unmarshal([]byte(configJSON), &sensorConfig); err != nil {
+		t.Fatalf("Error decoding configuration: %v", err)
+	}
+	if err := sensorConfig.Validate(); err != nil {
+		t.Fatalf("Expected a valid configuration, got:\n%v", err)
+	}
+
+	params := sensorConfig.Sensors[1].Params(sensorConfig.Config)
+	expected := simulator.SensorParams{StartingTemp: 800.0, MaxTempIncrease: 50.0, TempFluctuation: 2.0, MinTemp: 750.0, MaxTemp: 900.0}
+	if params != expected {
+		t.Errorf("Expected furnace parameters %+v, got %+v", expected, params)
+	}
+
+	generator := &simulator.Generator{Sensors: sensorConfig.Sensors, Config: sensorConfig.Config}
+	var data []simulator.TemperatureReading
+	captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	ranges := map[string][2]float64{"001": {-25.0, -15.0}, "002": {750.0, 900.0}, "003": {0.0, 40.0}}
+	for _, reading := range data {
+		r := ranges[reading.Sensor.ID]
+		if temp := float64(reading.Temperature); temp < r[0] || temp > r[1] {
+			t.Errorf("Reading of sensor %s at %.2f is outside [%g, %g]", reading.Sensor.ID, temp, r[0], r[1])
+		}
+	}
+
+	// The first freezer reading fluctuates by at most its own 0.5 degrees from its own start.
+	if diff := float64(data[0].Temperature) + 18.0; data[0].Sensor.ID != "001" || diff > 0.5+10.0/5 || diff < -0.5 {
+		t.Errorf("Unexpected first freezer reading: %+v", data[0])
+	}
+
+	// Overrides are settings, not metadata, so they must not be written with readings.
+	encoded, err := json.Marshal(data[0])
+	if err != nil {
+		t.Fatalf("Error encoding reading: %v", err)
+	}
+	if strings.Contains(string(encoded), "minTemp") {
+		t.Errorf("Expected reading without overrides, got %s", encoded)
+	}
+}
+
+// TestGeneratorSubSecondInterval tests that sub-second intervals produce millisecond timestamps.
+func TestGeneratorSubSecondInterval(t *testing.T) {
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}},
+		Config: simulator.Config{
+			TotalReadings: 4,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeBackfill,
+			StartTime:     "2024-03-01T00:00:00Z",
+			Interval:      simulator.Duration(250 * time.Millisecond),
+		},
+	}
+
+	var data []simulator.TemperatureReading
+	captureLogs(func(logger *slog.Logger) {
+		var err error
+		data, err = generator.Generate()
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+	})
+
+	expected := []string{"2024-03-01 00:00:00.250", "2024-03-01 00:00:00.500", "2024-03-01 00:00:00.750", "2024-03-01 00:00:01.000"}
+	for i, reading := range data {
+		if reading.Time != expected[i] {
+			t.Errorf("Expected time %s for reading %d, got %s", expected[i], i, reading.Time)
+		}
+	}
+}
+
+// TestGeneratorStream tests that readings are delivered over the channel while they are produced,
+// and that cancelling the context stops the generator and closes the channel.
+func TestGeneratorStream(t *testing.T) {
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}, {Name: "SensorB", ID: "002"}},
+		Config: simulator.Config{
+			TotalReadings: 1000000,
+			StartingTemp:  20.0,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeBackfill,
+			Seed:          7,
+		},
+	}
+
+	logOutput := captureLogs(func(logger *slog.Logger) {
+		generator.Logger = logger
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		readings := make(chan simulator.TemperatureReading)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- generator.Stream(ctx, readings)
+		}()
+
+		// Receive a few readings, then stop the generator long before it would finish.
+		for i := 0; i < 5; i++ {
+			reading, ok := <-readings
+			if !ok {
+				t.Fatal("Expected a reading, channel was closed")
+			}
+			if reading.Seed != 7 {
+				t.Errorf("Expected seed 7, got %d", reading.Seed)
+			}
+		}
+		cancel()
+
+		// The channel must be closed once the generator has stopped.
+		for range readings {
+		}
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	if !strings.Contains(logOutput, `msg="Temperature generation cancelled" readings=`) {
+		t.Errorf("Expected log message about cancelled generation, but got: %s", logOutput)
+	}
 }
 
 // TestSaveToJSON tests saving temperature readings to a JSON file.
 // It verifies that the data is correctly written to the file in the expected format
 // and that appropriate logging occurs during the saving process.
 func TestSaveToJSON(t *testing.T) {
-	// Set up the logger for capturing logs.
-	if err := simulator.SetupLogger("info", "stdout"); err != nil {
-		t.Fatalf("Failed to set up logger: %v", err)
-	}
-
 	// Define the temperature readings to be saved.
 	data := []simulator.TemperatureReading{
 		{
@@ -198,9 +1078,9 @@ func TestSaveToJSON(t *testing.T) {
 	tmpfile.Close()
 
 	// Capture logs during data saving.
-	logOutput := captureLogs(func() {
+	logOutput := captureLogs(func(logger *slog.Logger) {
 		// Save the data to the JSON file.
-		if err := simulator.SaveToJSON(data, tmpfile.Name()); err != nil {
+		if err := simulator.SaveToJSON(data, tmpfile.Name(), logger); err != nil {
 			t.Fatalf("Expected no error, got %v", err)
 		}
 	})
@@ -237,7 +1117,8 @@ func TestSaveToJSON(t *testing.T) {
 		if reading.Time != data[i].Time {
 			t.Errorf("Time mismatch on line %d.\nExpected: %s\nGot: %s", i+1, data[i].Time, reading.Time)
 		}
-		if reading.Sensor != data[i].Sensor {
+		got, want := reading.Sensor, data[i].Sensor
+		if got.Name != want.Name || got.ID != want.ID || got.Version != want.Version || got.Location != want.Location {
 			t.Errorf("Sensor mismatch on line %d.\nExpected: %+v\nGot: %+v", i+1, data[i].Sensor, reading.Sensor)
 		}
 
@@ -0,0 +1,225 @@
+package test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// testReadings returns a fixed set of readings for exercising sinks.
+func testReadings(n int) []simulator.TemperatureReading {
+	readings := make([]simulator.TemperatureReading, n)
+	for i := range readings {
+		readings[i] = simulator.TemperatureReading{
+			Time:        "2023-10-01 12:00:00",
+			Temperature: simulator.Temperature(20.0 + float64(i)),
+			Sensor:      simulator.Sensor{Name: "SensorA", ID: "001", Version: "v1.0", Location: "LocationA"},
+			Seed:        1,
+		}
+	}
+	return readings
+}
+
+// TestMultipleSinks tests that a configuration with several sinks delivers every reading to a file
+// and to an HTTP endpoint in batches.
+func TestMultipleSinks(t *testing.T) {
+	// Record every NDJSON line POSTed to the test server, along with the number of requests.
+	var mu sync.Mutex
+	var received []string
+	requests := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if ct := r.Header.Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("Expected NDJSON content type, got %s", ct)
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		requests++
+		scanner := bufio.NewScanner(r.Body)
+		for scanner.Scan() {
+			received = append(received, scanner.Text())
+		}
+	}))
+	defer server.Close()
+
+	outputPath := filepath.Join(t.TempDir(), "readings.json")
+	config := simulator.Config{
+		OutputFileName: outputPath,
+		Sinks: []simulator.SinkConfig{
+			{Type: "file"},
+			{Type: "http", URL: server.URL, BatchSize: 4},
+		},
+	}
+
+	sink, err := simulator.NewSinks(config, nil)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sinks, got %v", err)
+	}
+
+	// Deliver all readings at once so that flushing is driven by the batch size.
+	data := testReadings(10)
+	readings := make(chan simulator.TemperatureReading, len(data))
+	for _, reading := range data {
+		readings <- reading
+	}
+	close(readings)
+
+	captureLogs(func(logger *slog.Logger) {
+		count, err := simulator.WriteAll(sink, readings)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if count != len(data) {
+			t.Errorf("Expected %d readings written, got %d", len(data), count)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error closing sinks, got %v", err)
+		}
+	})
+
+	// The file sink must contain every reading.
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(content)), "\n")
+	if len(lines) != len(data) {
+		t.Errorf("Expected %d lines in file, got %d", len(data), len(lines))
+	}
+
+	// The HTTP sink must have received the same readings in batches of at most four.
+	if len(received) != len(data) {
+		t.Fatalf("Expected %d readings over HTTP, got %d", len(data), len(received))
+	}
+	if requests != 3 {
+		t.Errorf("Expected 3 requests, got %d", requests)
+	}
+	for i, line := range received {
+		var reading simulator.TemperatureReading
+		if err := json.Unmarshal([]byte(line), &reading); err != nil {
+			t.Fatalf("Error unmarshaling HTTP line %d: %v", i+1, err)
+		}
+		if reading.Temperature != data[i].Temperature {
+			t.Errorf("Temperature mismatch on HTTP line %d: expected %.2f, got %.2f", i+1, data[i].Temperature, reading.Temperature)
+		}
+	}
+}
+
+// TestHTTPSinkError tests that a failing HTTP endpoint is reported as an error.
+func TestHTTPSinkError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := &simulator.HTTPSink{URL: server.URL, BatchSize: 1}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sink, got %v", err)
+	}
+	captureLogs(func(logger *slog.Logger) {
+		if err := sink.Write(testReadings(1)[0]); err == nil {
+			t.Error("Expected error for failing endpoint, got nil")
+		}
+	})
+}
+
+// TestNewSinksInvalid tests that invalid sink configurations are rejected.
+func TestNewSinksInvalid(t *testing.T) {
+	invalid := []simulator.SinkConfig{
+		{Type: "carrier-pigeon"},
+		{Type: "http"},
+		{Type: "file"},
+	}
+	for _, sinkConfig := range invalid {
+		config := simulator.Config{Sinks: []simulator.SinkConfig{sinkConfig}}
+		if _, err := simulator.NewSinks(config, nil); err == nil {
+			t.Errorf("Expected error for sink %+v, got nil", sinkConfig)
+		}
+	}
+}
+
+// cancellingSink is a sink that cancels a context once a number of readings have been written to it.
+type cancellingSink struct {
+	simulator.Sink
+	after   int
+	written int
+	cancel  context.CancelFunc
+}
+
+// Write writes the reading to the wrapped sink and cancels the context when enough were written.
+func (s *cancellingSink) Write(reading simulator.TemperatureReading) error {
+	s.written++
+	if s.written == s.after {
+		s.cancel()
+	}
+	return s.Sink.Write(reading)
+}
+
+// TestWriteAllInterrupted tests that when a run is cancelled, as on SIGINT, every reading the
+// generator produced before stopping is still written and flushed to the output.
+func TestWriteAllInterrupted(t *testing.T) {
+	outputPath := filepath.Join(t.TempDir(), "readings.json")
+	generator := &simulator.Generator{
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}},
+		Config: simulator.Config{
+			TotalReadings: 100000,
+			MinTemp:       -10.0,
+			MaxTemp:       50.0,
+			Mode:          simulator.ModeBackfill,
+			Seed:          7,
+		},
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	sink := &cancellingSink{Sink: &simulator.JSONSink{Path: outputPath}, after: 5, cancel: cancel}
+	if err := sink.Open(); err != nil {
+		t.Fatalf("Expected no error opening sink, got %v", err)
+	}
+
+	var count int
+	captureLogs(func(logger *slog.Logger) {
+		generator.Logger = logger
+		readings := make(chan simulator.TemperatureReading, 64)
+		errc := make(chan error, 1)
+		go func() {
+			errc <- generator.Stream(ctx, readings)
+		}()
+
+		var err error
+		count, err = simulator.WriteAll(sink, readings)
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := sink.Close(); err != nil {
+			t.Fatalf("Expected no error closing sink, got %v", err)
+		}
+		if err := <-errc; !errors.Is(err, context.Canceled) {
+			t.Errorf("Expected context.Canceled, got %v", err)
+		}
+	})
+
+	if count < 5 || count >= 100000 {
+		t.Fatalf("Expected the run to stop early after at least 5 readings, got %d", count)
+	}
+	content, err := os.ReadFile(outputPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lines := strings.Count(string(content), "\n"); lines != count {
+		t.Errorf("Expected %d flushed lines, got %d", count, lines)
+	}
+}
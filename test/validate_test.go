@@ -0,0 +1,227 @@
+package test
+
+import (
+	"errors"
+	"log/slog"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"temperature-simulator/internal/simulator"
+)
+
+// TestValidate tests that every problem in a configuration is reported at once, each with the JSON
+// path of the offending setting.
+func TestValidate(t *testing.T) {
+	sensorConfig := simulator.SensorConfig{
+		Config: simulator.Config{
+			TotalReadings: -1,
+			StartingTemp:  20.0,
+			MinTemp:       60.0,
+			MaxTemp:       50.0,
+			Mode:          "fast",
+			Sinks:         []simulator.SinkConfig{{Type: "stdout"}, {Type: "http"}, {Type: "file"}},
+		},
+		Sensors: []simulator.Sensor{
+			{Name: "SensorA", ID: "001"},
+			{Name: "SensorB", ID: ""},
+			{Name: "SensorC", ID: "001"},
+		},
+	}
+
+	err := sensorConfig.Validate()
+	var validationErrs simulator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+
+	expected := []string{
+		"config.totalReadings: must not be negative, got -1",
+		"config.minTemp: 60 is greater than maxTemp 50",
+		`config.mode: must be one of backfill, realtime or accelerated, got "fast"`,
+		"config.sinks[1]: http sink requires a url",
+		"config.outputFileName: must not be empty when a file sink has no path",
+		"sensors[1].id: must not be empty",
+		`sensors[2].id: duplicate "001", also used by sensors[0]`,
+	}
+	if len(validationErrs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d:\n%v", len(expected), len(validationErrs), err)
+	}
+	for i, fieldErr := range validationErrs {
+		if fieldErr.Error() != expected[i] {
+			t.Errorf("Expected problem %q, got %q", expected[i], fieldErr.Error())
+		}
+	}
+	if !strings.Contains(err.Error(), expected[0]+"\n"+expected[1]) {
+		t.Errorf("Expected one problem per line, got: %s", err)
+	}
+}
+
+// TestValidateSinkFormats tests that the format and CSV settings used by file sinks without a path
+// of their own, including the default sink, are checked like those of other sinks.
+func TestValidateSinkFormats(t *testing.T) {
+	tests := []struct {
+		config   simulator.Config
+		expected []string
+	}{
+		{
+			simulator.Config{OutputFileName: "out.json", OutputFormat: "xml"},
+			[]string{"config.outputFormat: unknown output format: xml"},
+		},
+		{
+			simulator.Config{OutputFileName: "out.csv", CSVDelimiter: "||", CSVColumns: []string{"time", "temp"}},
+			[]string{
+				`config.csvDelimiter: CSV delimiter must be a single character, got "||"`,
+				"config.csvColumns: unknown CSV column: temp",
+			},
+		},
+		{
+			// Delimiters that the CSV writer refuses are reported before any sink is opened.
+			simulator.Config{OutputFileName: "out.csv", CSVDelimiter: "\n"},
+			[]string{`config.csvDelimiter: CSV delimiter must not be a quote, line break, null or invalid character, got "\n"`},
+		},
+		{
+			// Problems with global settings are reported once, however many sinks use them.
+			simulator.Config{OutputFileName: "out.json", OutputFormat: "csv", CSVColumns: []string{"temp"},
+				Sinks: []simulator.SinkConfig{{Type: "file"}, {Type: "stdout"}, {Type: "file", Path: "b.json", Format: "yaml"}}},
+			[]string{
+				"config.csvColumns: unknown CSV column: temp",
+				"config.sinks[2].format: unknown output format: yaml",
+			},
+		},
+	}
+	for _, tc := range tests {
+		sensorConfig := simulator.SensorConfig{Config: tc.config, Sensors: []simulator.Sensor{{ID: "001"}}}
+		err := sensorConfig.Validate()
+		var validationErrs simulator.ValidationErrors
+		if !errors.As(err, &validationErrs) {
+			t.Fatalf("Expected validation errors, got %v", err)
+		}
+		if len(validationErrs) != len(tc.expected) {
+			t.Fatalf("Expected %d problems, got %d:\n%v", len(tc.expected), len(validationErrs), err)
+		}
+		for i, fieldErr := range validationErrs {
+			if fieldErr.Error() != tc.expected[i] {
+				t.Errorf("Expected problem %q, got %q", tc.expected[i], fieldErr.Error())
+			}
+		}
+	}
+}
+
+// TestValidateUnboundedBackfill tests that runs without an end are only accepted when they are paced
+// by the clock.
+func TestValidateUnboundedBackfill(t *testing.T) {
+	for _, config := range []simulator.Config{{Mode: simulator.ModeBackfill}, {Simulate: true}} {
+		config.OutputFileName = "out.json"
+		sensorConfig := simulator.SensorConfig{Config: config, Sensors: []simulator.Sensor{{ID: "001"}}}
+		expected := "config.totalReadings: must be positive in backfill mode unless duration or until is set"
+		if err := sensorConfig.Validate(); err == nil || err.Error() != expected {
+			t.Errorf("Expected problem %q, got %v", expected, err)
+		}
+	}
+
+	valid := []simulator.Config{
+		{Mode: simulator.ModeBackfill, Duration: simulator.Duration(time.Hour)},
+		{Mode: simulator.ModeBackfill, Until: "2024-03-02T00:00:00Z"},
+		{Mode: simulator.ModeRealtime},
+		{Mode: simulator.ModeAccelerated},
+	}
+	for _, config := range valid {
+		config.OutputFileName = "out.json"
+		sensorConfig := simulator.SensorConfig{Config: config, Sensors: []simulator.Sensor{{ID: "001"}}}
+		if err := sensorConfig.Validate(); err != nil {
+			t.Errorf("Expected config %+v to be valid, got %v", config, err)
+		}
+	}
+}
+
+// TestValidateStdoutLogs tests that logs cannot be written to stdout together with readings.
+func TestValidateStdoutLogs(t *testing.T) {
+	configs := []simulator.Config{
+		{LogFilePath: "stdout", Sinks: []simulator.SinkConfig{{Type: "file", Path: "out.json"}, {Type: "stdout"}}},
+		{LogFilePath: "stdout", OutputFileName: "stdout"},
+	}
+	for _, config := range configs {
+		if !config.WritesToStdout() {
+			t.Errorf("Expected config %+v to write readings to stdout", config)
+		}
+		sensorConfig := simulator.SensorConfig{Config: config, Sensors: []simulator.Sensor{{ID: "001"}}}
+		expected := "config.logFilePath: must not be stdout when readings are written to stdout; use stderr or a file"
+		if err := sensorConfig.Validate(); err == nil || err.Error() != expected {
+			t.Errorf("Expected problem %q, got %v", expected, err)
+		}
+	}
+
+	// Logs may go to stderr, and to stdout when the readings go elsewhere.
+	valid := []simulator.Config{
+		{LogFilePath: "stderr", Sinks: []simulator.SinkConfig{{Type: "stdout"}}},
+		{LogFilePath: "stdout", OutputFileName: "out.json"},
+	}
+	for _, config := range valid {
+		sensorConfig := simulator.SensorConfig{Config: config, Sensors: []simulator.Sensor{{ID: "001"}}}
+		if err := sensorConfig.Validate(); err != nil {
+			t.Errorf("Expected config %+v to be valid, got %v", config, err)
+		}
+	}
+}
+
+// TestValidateStartingTemp tests that a starting temperature outside the min/max range is reported.
+func TestValidateStartingTemp(t *testing.T) {
+	sensorConfig := simulator.SensorConfig{
+		Config:  simulator.Config{StartingTemp: 70.0, MinTemp: -10.0, MaxTemp: 50.0, OutputFileName: "out.json"},
+		Sensors: []simulator.Sensor{{Name: "SensorA", ID: "001"}},
+	}
+	err := sensorConfig.Validate()
+	if err == nil || err.Error() != "config.startingTemp: 70 is outside the range [-10, 50]" {
+		t.Errorf("Expected starting temperature problem, got %v", err)
+	}
+}
+
+// TestValidateSensorOverrides tests that temperature parameters overridden by a sensor are checked
+// together with the global parameters they are combined with.
+func TestValidateSensorOverrides(t *testing.T) {
+	temp := func(value float64) *float64 { return &value }
+	sensorConfig := simulator.SensorConfig{
+		Config: simulator.Config{StartingTemp: 20.0, MinTemp: 0.0, MaxTemp: 40.0, OutputFileName: "out.json"},
+		Sensors: []simulator.Sensor{
+			{Name: "Freezer", ID: "001", StartingTemp: temp(-18.0), MinTemp: temp(-25.0), MaxTemp: temp(-15.0)},
+			{Name: "Furnace", ID: "002", MinTemp: temp(750.0)},
+			{Name: "Oven", ID: "003", MaxTemp: temp(250.0), StartingTemp: temp(300.0)},
+			{Name: "Fridge", ID: "004", MaxTemp: temp(8.0), TempFluctuation: temp(-1.0)},
+		},
+	}
+
+	err := sensorConfig.Validate()
+	var validationErrs simulator.ValidationErrors
+	if !errors.As(err, &validationErrs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	expected := []string{
+		"sensors[1].minTemp: 750 is greater than maxTemp 40",
+		"sensors[2].startingTemp: 300 is outside the range [0, 250]",
+		"sensors[3].startingTemp: 20 is outside the range [0, 8]",
+		"sensors[3].tempFluctuation: must not be negative, got -1",
+	}
+	if len(validationErrs) != len(expected) {
+		t.Fatalf("Expected %d problems, got %d:\n%v", len(expected), len(validationErrs), err)
+	}
+	for i, fieldErr := range validationErrs {
+		if fieldErr.Error() != expected[i] {
+			t.Errorf("Expected problem %q, got %q", expected[i], fieldErr.Error())
+		}
+	}
+}
+
+// TestValidateConfigFile tests that the bundled test configuration is valid.
+func TestValidateConfigFile(t *testing.T) {
+	captureLogs(func(logger *slog.Logger) {
+		sensorConfig, err := simulator.LoadConfigAndSensors(filepath.Join("..", "configs", "test_sensors.json"), logger, simulator.LoadOptions{})
+		if err != nil {
+			t.Fatalf("Expected no error, got %v", err)
+		}
+		if err := sensorConfig.Validate(); err != nil {
+			t.Errorf("Expected a valid configuration, got:\n%v", err)
+		}
+	})
+}